@@ -0,0 +1,134 @@
+package goic
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// The types of AuthEvent
+const (
+	EventLogin   = "login"
+	EventLogout  = "logout"
+	EventRefresh = "refresh"
+	EventRevoke  = "revoke"
+)
+
+// AuthEvent is security relevant authentication event for audit trail
+type AuthEvent struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`    // login, logout, refresh or revoke
+	Outcome   string    `json:"outcome"` // success or failure
+	Reason    string    `json:"reason,omitempty"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"sub,omitempty"`
+	SID       string    `json:"sid,omitempty"` // provider session ID, for logout initiated by Provider
+	ACR       string    `json:"acr,omitempty"`
+	AMR       []string  `json:"amr,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// AuditSink receives the AuthEvents, it must be safe for concurrent use
+type AuditSink interface {
+	Audit(ctx context.Context, e *AuthEvent) error
+}
+
+// FileAuditSink is AuditSink that appends AuthEvents to a file as JSON lines
+type FileAuditSink struct {
+	f  *os.File
+	mu sync.Mutex
+}
+
+// WithAudit sets the AuditSink to emit AuthEvents to
+func (g *Goic) WithAudit(s AuditSink) *Goic {
+	g.auditSink = s
+	return g
+}
+
+// NewFileAuditSink gives new FileAuditSink appending to file at path, creating it if needed
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{f: f}, nil
+}
+
+// Audit implements AuditSink
+func (s *FileAuditSink) Audit(_ context.Context, e *AuthEvent) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(buf, '\n'))
+	return err
+}
+
+// Close closes the underlying file
+func (s *FileAuditSink) Close() error {
+	return s.f.Close()
+}
+
+// audit emits AuthEvent of given type for Token of provider to AuditSink
+// The req is optional, it gives the IP and user agent of client.
+// Claims are recorded only on success, as they may not be verified otherwise.
+func (g *Goic) audit(req *http.Request, typ, provider string, tok *Token, err error) {
+	if g.auditSink == nil {
+		return
+	}
+
+	e := newEvent(typ, provider, err)
+	if err == nil && tok != nil && tok.Claims != nil {
+		e.Subject, e.ACR = claimString(tok.Claims, "sub"), claimString(tok.Claims, "acr")
+		e.AMR = claimValues(tok.Claims, "amr")
+	}
+	g.emit(req, e)
+}
+
+// auditLogout emits logout AuthEvent initiated by Provider for sub and/or sid to AuditSink
+func (g *Goic) auditLogout(req *http.Request, provider, sub, sid string, err error) {
+	if g.auditSink == nil {
+		return
+	}
+
+	e := newEvent(EventLogout, provider, err)
+	e.Subject, e.SID = sub, sid
+	g.emit(req, e)
+}
+
+// newEvent gives AuthEvent of given type with outcome as per err
+func newEvent(typ, provider string, err error) *AuthEvent {
+	e := &AuthEvent{Time: time.Now().UTC(), Type: typ, Outcome: "success", Provider: provider}
+	if err != nil {
+		e.Outcome, e.Reason = "failure", redactString(err.Error())
+	}
+	return e
+}
+
+// emit sends AuthEvent to AuditSink, logging the error if any
+func (g *Goic) emit(req *http.Request, e *AuthEvent) {
+	ctx := context.Background()
+	if req != nil {
+		ctx, e.IP, e.UserAgent = req.Context(), clientIP(req), req.UserAgent()
+	}
+	if err := g.auditSink.Audit(ctx, e); err != nil {
+		g.logger.ErrorContext(ctx, "goic audit failed", "type", e.Type, "provider", e.Provider, "error", err)
+	}
+}
+
+// clientIP gives IP address of the client of req
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
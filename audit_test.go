@@ -0,0 +1,60 @@
+package goic
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testSink is AuditSink that keeps the events in memory
+type testSink struct {
+	events []*AuthEvent
+	mu     sync.Mutex
+}
+
+func (s *testSink) Audit(_ context.Context, e *AuthEvent) error {
+	s.mu.Lock()
+	s.events = append(s.events, e)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestAuditUnverifiedClaims(t *testing.T) {
+	sink := &testSink{}
+	g := New("/auth", false).WithAudit(sink)
+	tok := &Token{Claims: jwt.MapClaims{"sub": "attacker", "acr": "high"}}
+
+	g.audit(nil, EventLogin, "idp", tok, errors.New("bad signature"))
+	g.audit(nil, EventLogin, "idp", tok, nil)
+
+	if e := sink.events[0]; e.Outcome != "failure" || e.Subject != "" || e.ACR != "" {
+		t.Errorf("expected failed login without claims, got %+v", e)
+	}
+	if e := sink.events[1]; e.Outcome != "success" || e.Subject != "attacker" || e.ACR != "high" {
+		t.Errorf("expected successful login with claims, got %+v", e)
+	}
+}
+
+func TestAuditBackchannelLogout(t *testing.T) {
+	sink := &testSink{}
+	g := New("/auth", false).WithAudit(sink)
+	testProvider(g, "idp", nil)
+
+	form := url.Values{"logout_token": {signToken(t, logoutClaims("audit"))}}
+	req := httptest.NewRequest("POST", "/auth/idp/backchannel-logout", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	g.MiddlewareHandler(nil).ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected one event, got %d", len(sink.events))
+	}
+	if e := sink.events[0]; e.Type != EventLogout || e.Outcome != "success" || e.Subject != "user" || e.SID != "sid1" {
+		t.Errorf("expected logout event with sub and sid, got %+v", e)
+	}
+}
@@ -0,0 +1,140 @@
+package goic
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// roleClaims are default claim paths to look for roles and groups
+// It covers generic, Azure (roles, groups) and Keycloak (realm_access.roles).
+var roleClaims = []string{"roles", "groups", "realm_access.roles"}
+
+// RequireClaim gives middleware that allows only if the claim at path has any of given values
+// The path can be nested with dots, eg: realm_access.roles. If no values are given,
+// the claim only needs to be present. It must be used after RequireAuth or RequireBearer.
+func (g *Goic) RequireClaim(path string, values ...string) func(http.Handler) http.Handler {
+	return g.authorize(func(tok *Token) bool {
+		have := claimValues(tok.Claims, path)
+		if len(values) == 0 {
+			return len(have) > 0
+		}
+		return anyOf(have, values)
+	})
+}
+
+// RequireAnyRole gives middleware that allows only if the user has any of given roles
+// The roles are looked up in claim paths of the Provider, see Provider.WithRoleClaims.
+func (g *Goic) RequireAnyRole(roles ...string) func(http.Handler) http.Handler {
+	return g.authorize(func(tok *Token) bool {
+		return anyOf(g.Roles(tok), roles)
+	})
+}
+
+// RequireScope gives middleware that allows only if the token has all given scopes
+func (g *Goic) RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return g.authorize(func(tok *Token) bool {
+		have := Scopes(tok)
+		for _, s := range scopes {
+			if !anyOf(have, []string{s}) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Roles gives the roles and groups of Token from the claim paths of its Provider
+func (g *Goic) Roles(tok *Token) (roles []string) {
+	paths := roleClaims
+	if p := g.GetProvider(tok.Provider); p != nil && len(p.RoleClaims) > 0 {
+		paths = p.RoleClaims
+	}
+
+	for _, path := range paths {
+		roles = append(roles, claimValues(tok.Claims, path)...)
+	}
+	return roles
+}
+
+// Scopes gives the granted scopes of Token, from its claims (scope, scp) or token response
+func Scopes(tok *Token) []string {
+	for _, path := range []string{"scope", "scp"} {
+		if s := claimValues(tok.Claims, path); len(s) > 0 {
+			return s
+		}
+	}
+	return strings.Fields(tok.Scope)
+}
+
+// authorize gives middleware that allows only if Token in context satisfies the check
+func (g *Goic) authorize(check func(tok *Token) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			tok := TokenFromContext(req.Context())
+			if tok == nil {
+				deny(res, req, http.StatusUnauthorized, "unauthorized", "authentication required")
+				return
+			}
+			if !check(tok) {
+				deny(res, req, http.StatusForbidden, "forbidden", "insufficient permission")
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// deny writes error response as JSON for API clients and plain text otherwise
+func deny(res http.ResponseWriter, req *http.Request, status int, code, desc string) {
+	if !wantsJSON(req) {
+		http.Error(res, http.StatusText(status), status)
+		return
+	}
+	writeJSON(res, status, map[string]string{"error": code, "error_description": desc})
+}
+
+// claimValues gives the values of claim at dotted path as strings
+// Space separated string values of scope claims are split into many.
+func claimValues(c jwt.MapClaims, path string) (values []string) {
+	var val any = map[string]any(c)
+	for _, key := range strings.Split(path, ".") {
+		m, ok := val.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if val, ok = m[key]; !ok {
+			return nil
+		}
+	}
+
+	switch v := val.(type) {
+	case string:
+		if path == "scope" || path == "scp" {
+			return strings.Fields(v)
+		}
+		return []string{v}
+	case []any:
+		for _, s := range v {
+			values = append(values, fmt.Sprint(s))
+		}
+	case nil:
+	default:
+		values = append(values, fmt.Sprint(v))
+	}
+	return values
+}
+
+// anyOf checks if any of want is in have
+func anyOf(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package goic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrTokenIssuer is error for access_token from unknown issuer
+	ErrTokenIssuer = fmt.Errorf("goic access_token: unknown issuer")
+
+	// ErrTokenType is error for access_token that is not of type at+jwt
+	ErrTokenType = fmt.Errorf("goic access_token: invalid typ, expected at+jwt")
+)
+
+// accessAlgos are the signing algos allowed for JWT access tokens
+// Symmetric algos are not allowed as resource server does not share any secret.
+var accessAlgos = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// VerifyAccessToken verifies JWT access token as per RFC9068 for given audience
+// The Provider is selected by the issuer (iss) of the token, and token is verified
+// against its jwks keys. It gives the Token with verified claims on success.
+func (g *Goic) VerifyAccessToken(raw, aud string) (*Token, error) {
+	unverified, err := decodeClaims(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p := g.providerByIssuer(claimString(unverified, "iss"))
+	if p == nil {
+		return nil, ErrTokenIssuer
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		typ, _ := t.Header["typ"].(string)
+		typ = strings.TrimPrefix(strings.ToLower(typ), "application/")
+		if typ != "at+jwt" {
+			return nil, ErrTokenType
+		}
+		return p.publicKey(t)
+	},
+		jwt.WithValidMethods(accessAlgos),
+		jwt.WithIssuer(p.wk().Issuer),
+		jwt.WithAudience(aud),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tok := &Token{AccessToken: raw, TokenType: "Bearer", Provider: p.Name, Claims: claims}
+	tok.Scope = strings.Join(Scopes(tok), " ")
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		tok.Expiry = exp.Time
+	}
+	return tok, nil
+}
+
+// RequireBearer gives middleware for resource servers that allows only requests with
+// valid JWT access token in Authorization header, for given audience and scopes.
+// The verified Token and its claims are available in request context of the next handler.
+func (g *Goic) RequireBearer(aud string, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			raw, ok := bearerToken(req)
+			if !ok {
+				res.Header().Set("WWW-Authenticate", `Bearer realm="goic"`)
+				deny(res, req, http.StatusUnauthorized, "invalid_request", "bearer token required")
+				return
+			}
+
+			tok, err := g.VerifyAccessToken(raw, aud)
+			if err != nil {
+				g.logger.InfoContext(req.Context(), "goic bearer token rejected", "error", err)
+				res.Header().Set("WWW-Authenticate", `Bearer realm="goic", error="invalid_token"`)
+				deny(res, req, http.StatusUnauthorized, "invalid_token", "access token is invalid")
+				return
+			}
+
+			have := Scopes(tok)
+			for _, s := range scopes {
+				if !anyOf(have, []string{s}) {
+					res.Header().Set("WWW-Authenticate", `Bearer realm="goic", error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+					deny(res, req, http.StatusForbidden, "insufficient_scope", "access token lacks required scope")
+					return
+				}
+			}
+
+			ctx := withAuth(req.Context(), &User{Subject: claimString(tok.Claims, "sub")}, tok)
+			next.ServeHTTP(res, req.WithContext(context.WithValue(ctx, claimsKey, tok.Claims)))
+		})
+	}
+}
+
+// ClaimsFromContext gives the verified access token claims put in context by RequireBearer
+func ClaimsFromContext(ctx context.Context) jwt.MapClaims {
+	c, _ := ctx.Value(claimsKey).(jwt.MapClaims)
+	return c
+}
+
+// providerByIssuer gives the Provider whose well-known issuer is iss, nil if none
+func (g *Goic) providerByIssuer(iss string) *Provider {
+	if iss == "" {
+		return nil
+	}
+	for _, p := range g.Providers() {
+		if p.wk().Issuer == iss {
+			return p
+		}
+	}
+	return nil
+}
+
+// bearerToken gives the bearer token from Authorization header
+func bearerToken(req *http.Request) (string, bool) {
+	auth := req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+
+	tok := strings.TrimSpace(auth[7:])
+	return tok, tok != ""
+}
@@ -0,0 +1,144 @@
+package goic
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// accessClaims gives valid access token claims as per RFC9068
+func accessClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   "api",
+		"sub":   "user",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"scope": "read write",
+	}
+}
+
+// accessToken signs claims with given method, with typ header if not empty
+func accessToken(t *testing.T, method jwt.SigningMethod, typ string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	tok.Header["kid"] = "k1"
+	if typ != "" {
+		tok.Header["typ"] = typ
+	}
+
+	var key any = testRSA
+	switch method {
+	case jwt.SigningMethodHS256:
+		key = []byte("guessed secret")
+	case jwt.SigningMethodNone:
+		key = jwt.UnsafeAllowNoneSignatureType
+	}
+
+	raw, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestVerifyAccessToken(t *testing.T) {
+	g := New("/auth", false)
+	testProvider(g, "idp", nil)
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		typ    string
+		modify func(c jwt.MapClaims)
+		err    error // nil for valid
+	}{
+		{name: "valid", typ: "at+jwt"},
+		{name: "media typ", typ: "application/at+jwt"},
+		{name: "no typ", err: ErrTokenType},
+		{name: "jwt typ", typ: "JWT", err: ErrTokenType},
+		{name: "unknown iss", typ: "at+jwt", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }, err: ErrTokenIssuer},
+		{name: "no iss", typ: "at+jwt", modify: func(c jwt.MapClaims) { delete(c, "iss") }, err: ErrTokenIssuer},
+		{name: "wrong aud", typ: "at+jwt", modify: func(c jwt.MapClaims) { c["aud"] = "other" }, err: jwt.ErrTokenInvalidAudience},
+		{name: "no exp", typ: "at+jwt", modify: func(c jwt.MapClaims) { delete(c, "exp") }, err: jwt.ErrTokenRequiredClaimMissing},
+		{name: "expired", typ: "at+jwt", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, err: jwt.ErrTokenExpired},
+		{name: "symmetric alg", method: jwt.SigningMethodHS256, typ: "at+jwt", err: jwt.ErrTokenSignatureInvalid},
+		{name: "none alg", method: jwt.SigningMethodNone, typ: "at+jwt", err: jwt.ErrTokenSignatureInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := accessClaims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			if tt.method == nil {
+				tt.method = jwt.SigningMethodRS256
+			}
+
+			tok, err := g.VerifyAccessToken(accessToken(t, tt.method, tt.typ, claims), "api")
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("expected valid, got %v", err)
+				}
+				if tok.Provider != "idp" || tok.Scope != "read write" || tok.Expiry.IsZero() {
+					t.Errorf("expected verified Token, got %+v", tok)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRequireBearer(t *testing.T) {
+	g := New("/auth", false)
+	testProvider(g, "idp", nil)
+	handler := g.RequireBearer("api", "write")(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte(claimString(ClaimsFromContext(req.Context()), "sub")))
+	}))
+
+	readOnly := accessClaims()
+	readOnly["scope"] = "read"
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+		header string // expected in WWW-Authenticate
+	}{
+		{name: "valid", auth: "Bearer " + accessToken(t, jwt.SigningMethodRS256, "at+jwt", accessClaims()), status: http.StatusOK},
+		{name: "missing", status: http.StatusUnauthorized, header: `Bearer realm="goic"`},
+		{name: "basic", auth: "Basic dXNlcjpwYXNz", status: http.StatusUnauthorized, header: `Bearer realm="goic"`},
+		{name: "invalid", auth: "Bearer " + accessToken(t, jwt.SigningMethodRS256, "", accessClaims()), status: http.StatusUnauthorized, header: `error="invalid_token"`},
+		{name: "scope", auth: "Bearer " + accessToken(t, jwt.SigningMethodRS256, "at+jwt", readOnly), status: http.StatusForbidden, header: `error="insufficient_scope", scope="write"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); !strings.Contains(got, tt.header) {
+				t.Errorf("expected WWW-Authenticate with %q, got %q", tt.header, got)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != "user" {
+				t.Errorf("expected claims in context, got %q", rec.Body.String())
+			}
+		})
+	}
+}
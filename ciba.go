@@ -0,0 +1,212 @@
+package goic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCIBAExpired is error for backchannel auth request that expired before user authorized
+var ErrCIBAExpired = fmt.Errorf("goic ciba: auth request expired")
+
+// CIBARequest represents client initiated backchannel authentication request
+// One of LoginHint, LoginHintToken or IDTokenHint is required to identify the user.
+type CIBARequest struct {
+	LoginHint       string
+	LoginHintToken  string
+	IDTokenHint     string
+	BindingMessage  string // shown to user on both devices
+	Scope           string // defaults to Provider scope
+	ACRValues       string
+	RequestedExpiry int
+	// Ping enables ping mode, where Provider notifies at <URIPrefix>/<name>/ciba
+	// when user has authorized. The endpoint must be registered with Provider.
+	Ping bool
+}
+
+// CIBAuth represents backchannel authentication response
+type CIBAuth struct {
+	Expiry    time.Time `json:"-"`
+	notify    chan struct{}
+	once      sync.Once
+	AuthReqID string `json:"auth_req_id"`
+	Provider  string `json:"provider,omitempty"`
+	notifyTok string
+	ExpiresIn int64 `json:"expires_in"`
+	Interval  int64 `json:"interval,omitempty"`
+}
+
+// BackchannelAuth starts client initiated backchannel authentication (CIBA) with Provider
+// The user authenticates on their own device, use BackchannelToken to get the Token.
+func (g *Goic) BackchannelAuth(ctx context.Context, p *Provider, r *CIBARequest) (*CIBAuth, error) {
+	p, ok := g.provider(p.Name)
+	if !ok || !p.CanCIBA() {
+		return nil, ErrProviderSupport
+	}
+
+	qry := url.Values{}
+	qry.Add("scope", orDefault(r.Scope, p.Scope))
+	for k, v := range map[string]string{
+		"login_hint":       r.LoginHint,
+		"login_hint_token": r.LoginHintToken,
+		"id_token_hint":    r.IDTokenHint,
+		"binding_message":  r.BindingMessage,
+		"acr_values":       r.ACRValues,
+	} {
+		if v != "" {
+			qry.Add(k, v)
+		}
+	}
+	if r.RequestedExpiry > 0 {
+		qry.Add("requested_expiry", strconv.Itoa(r.RequestedExpiry))
+	}
+
+	auth := &CIBAuth{Provider: p.Name}
+	if r.Ping {
+		auth.notifyTok, auth.notify = randomID(), make(chan struct{})
+		qry.Add("client_notification_token", auth.notifyTok)
+	}
+
+	body, res, err := g.postForm(ctx, p, p.GetURI("ciba"), qry, ClientSecretPost)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, oauthError(body, res.StatusCode, p, "ciba")
+	}
+	if err := json.Unmarshal(body, auth); err != nil {
+		return nil, err
+	}
+
+	if auth.ExpiresIn > 0 {
+		auth.Expiry = time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	}
+	if r.Ping {
+		g.cLock.Lock()
+		for k, v := range g.cibaAuths {
+			if !v.Expiry.IsZero() && time.Now().After(v.Expiry) {
+				delete(g.cibaAuths, k)
+			}
+		}
+		g.cibaAuths[auth.notifyTok] = auth
+		g.cLock.Unlock()
+	}
+	return auth, nil
+}
+
+// BackchannelToken waits until user authorizes the CIBAuth and gives the verified Token
+// In poll mode it polls token endpoint honoring interval and slow_down,
+// in ping mode it waits for notification from Provider before requesting the token.
+func (g *Goic) BackchannelToken(ctx context.Context, auth *CIBAuth) (*Token, error) {
+	p := g.GetProvider(auth.Provider)
+	if p == nil {
+		return nil, ErrProviderSupport
+	}
+	if auth.notify != nil {
+		defer func() {
+			g.cLock.Lock()
+			delete(g.cibaAuths, auth.notifyTok)
+			g.cLock.Unlock()
+		}()
+	}
+
+	interval := deviceInterval
+	if auth.Interval > 0 {
+		interval = time.Duration(auth.Interval) * time.Second
+	}
+
+	qry := url.Values{}
+	qry.Add("grant_type", "urn:openid:params:grant-type:ciba")
+	qry.Add("auth_req_id", auth.AuthReqID)
+
+	for {
+		if err := auth.wait(ctx, interval); err != nil {
+			return nil, err
+		}
+
+		tok, err := g.tokenRequest(ctx, p, qry)
+		switch tok.Err {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += deviceInterval
+			continue
+		case "expired_token":
+			return nil, ErrCIBAExpired
+		}
+
+		if err != nil {
+			return tok, fmt.Errorf("get token: %w", err)
+		}
+		if err := g.verifyToken(p, tok, ""); err != nil {
+			return tok, fmt.Errorf("verify token: %w", err)
+		}
+		return tok, nil
+	}
+}
+
+// wait waits for the interval in poll mode, or notification in ping mode
+// The Expiry is not enforced if Provider did not give expires_in.
+func (a *CIBAuth) wait(ctx context.Context, interval time.Duration) error {
+	if !a.Expiry.IsZero() && !time.Now().Before(a.Expiry) {
+		return ErrCIBAExpired
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	timeout := timer.C
+	if a.notify != nil {
+		timeout = nil // ping mode waits only for notification until expiry
+		if !a.Expiry.IsZero() {
+			timer.Reset(time.Until(a.Expiry))
+			timeout = timer.C
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-a.notify:
+		a.notify = nil // any further wait is poll
+		return nil
+	case <-timeout:
+		if a.notify != nil {
+			return ErrCIBAExpired
+		}
+		return nil
+	}
+}
+
+// cibaNotify handles the ping notification from Provider for CIBA
+func (g *Goic) cibaNotify(res http.ResponseWriter, req *http.Request, p *Provider) {
+	tk, ok := bearerToken(req)
+	if req.Method != http.MethodPost || !ok {
+		http.Error(res, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var ping struct {
+		AuthReqID string `json:"auth_req_id"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&ping); err != nil {
+		http.Error(res, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	g.cLock.Lock()
+	auth, ok := g.cibaAuths[tk]
+	g.cLock.Unlock()
+	if !ok || auth.Provider != p.Name || auth.AuthReqID != ping.AuthReqID {
+		http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	auth.once.Do(func() { close(auth.notify) })
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package goic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// cibaGoic gives Goic with Provider whose CIBA endpoint responds with body and records the form,
+// and whose token endpoint responds with the scripted bodies as pollServer
+func cibaGoic(t *testing.T, body string, bodies ...string) (*Goic, func() url.Values, func() []time.Time) {
+	var mu sync.Mutex
+	var form url.Values
+	ciba := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_ = req.ParseForm()
+		mu.Lock()
+		form = req.PostForm
+		mu.Unlock()
+		_, _ = res.Write([]byte(body))
+	}))
+	t.Cleanup(ciba.Close)
+
+	srv, polls := pollServer(t, bodies...)
+	g := New("/auth", false)
+	testProvider(g, "idp", &WellKnown{CIBAuthURI: ciba.URL, TokenURI: srv.URL})
+
+	return g, func() url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+		return form
+	}, polls
+}
+
+// cibaGranted gives token response with id_token for test Provider
+func cibaGranted(t *testing.T) string {
+	idt := signToken(t, jwt.MapClaims{"iss": testIssuer, "aud": "client", "sub": "u", "exp": time.Now().Add(time.Minute).Unix()})
+	return `{"access_token":"at","token_type":"Bearer","id_token":"` + idt + `"}`
+}
+
+func TestBackchannelPoll(t *testing.T) {
+	fastPoll(t)
+	granted := cibaGranted(t)
+	g, form, polls := cibaGoic(t, `{"auth_req_id":"r1"}`, `{"error":"authorization_pending"}`, `{"error":"slow_down"}`, granted)
+
+	auth, err := g.BackchannelAuth(context.Background(), g.GetProvider("idp"), &CIBARequest{LoginHint: "u@v.w"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.Expiry.IsZero() || form().Get("login_hint") != "u@v.w" {
+		t.Fatalf("expected no expiry without expires_in, got %v %v", auth.Expiry, form())
+	}
+
+	tok, err := g.BackchannelToken(context.Background(), auth)
+	if err != nil || tok.AccessToken != "at" {
+		t.Fatalf("expected token after polling, got %+v %v", tok, err)
+	}
+
+	got := polls()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 polls, got %d", len(got))
+	}
+	if gap := got[2].Sub(got[1]); gap < 2*deviceInterval {
+		t.Errorf("expected interval to grow after slow_down, got %s", gap)
+	}
+}
+
+func TestBackchannelExpired(t *testing.T) {
+	fastPoll(t)
+	g, _, polls := cibaGoic(t, `{"auth_req_id":"r1","expires_in":60}`, `{"error":"expired_token"}`)
+
+	auth, err := g.BackchannelAuth(context.Background(), g.GetProvider("idp"), &CIBARequest{LoginHint: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Expiry.IsZero() {
+		t.Error("expected expiry from expires_in")
+	}
+	if _, err := g.BackchannelToken(context.Background(), auth); err != ErrCIBAExpired {
+		t.Errorf("expected ErrCIBAExpired, got %v", err)
+	}
+	if n := len(polls()); n != 1 {
+		t.Errorf("expected polling to stop at expired_token, got %d polls", n)
+	}
+}
+
+func TestBackchannelPing(t *testing.T) {
+	fastPoll(t)
+	g, form, polls := cibaGoic(t, `{"auth_req_id":"r1","expires_in":60}`, cibaGranted(t))
+
+	auth, err := g.BackchannelAuth(context.Background(), g.GetProvider("idp"), &CIBARequest{LoginHint: "u", Ping: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifyTok := form().Get("client_notification_token")
+	if notifyTok == "" {
+		t.Fatal("expected client_notification_token in ping mode")
+	}
+
+	done := make(chan *Token, 1)
+	go func() {
+		tok, err := g.BackchannelToken(context.Background(), auth)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- tok
+	}()
+
+	ping := func(method, tk, body string) int {
+		req := httptest.NewRequest(method, "/auth/idp/ciba", strings.NewReader(body))
+		if tk != "" {
+			req.Header.Set("Authorization", "Bearer "+tk)
+		}
+		rec := httptest.NewRecorder()
+		g.MiddlewareHandler(nil).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	time.Sleep(3 * deviceInterval)
+	for _, tt := range []struct {
+		method, tk, body string
+		status           int
+	}{
+		{method: "GET", tk: notifyTok, body: `{"auth_req_id":"r1"}`, status: http.StatusBadRequest},
+		{method: "POST", body: `{"auth_req_id":"r1"}`, status: http.StatusBadRequest},
+		{method: "POST", tk: "wrong", body: `{"auth_req_id":"r1"}`, status: http.StatusUnauthorized},
+		{method: "POST", tk: notifyTok, body: `{"auth_req_id":"r2"}`, status: http.StatusUnauthorized},
+	} {
+		if code := ping(tt.method, tt.tk, tt.body); code != tt.status {
+			t.Errorf("%s ping with %q %s: expected %d, got %d", tt.method, tt.tk, tt.body, tt.status, code)
+		}
+	}
+	if n := len(polls()); n != 0 {
+		t.Fatalf("expected no polling before ping, got %d polls", n)
+	}
+
+	if code := ping("POST", notifyTok, `{"auth_req_id":"r1"}`); code != http.StatusNoContent {
+		t.Fatalf("expected ping to be accepted, got %d", code)
+	}
+	select {
+	case tok := <-done:
+		if tok == nil || tok.AccessToken != "at" || len(polls()) != 1 {
+			t.Errorf("expected token right after ping, got %+v with %d polls", tok, len(polls()))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected token after ping")
+	}
+}
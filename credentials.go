@@ -0,0 +1,74 @@
+package goic
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ccEntry is cached client credentials Token for a scope and audience
+type ccEntry struct {
+	tok      *Token
+	provider string
+	mu       sync.Mutex
+}
+
+// ClientCredentials gets service to service Token with client credentials grant
+// The audience if given is sent as audience, and also as resource (RFC8707) if it is
+// absolute URI. The Token is cached until it is about to expire. The client is
+// authenticated with ClientAuth of Provider, defaults to ClientSecretPost.
+func (g *Goic) ClientCredentials(ctx context.Context, p *Provider, scopes []string, audience string) (*Token, error) {
+	p, ok := g.provider(p.Name)
+	if !ok {
+		return nil, ErrProviderSupport
+	}
+
+	scope := strings.Join(scopes, " ")
+	key := cacheKey(p.Name, scope, audience)
+
+	g.ccLock.Lock()
+	e, ok := g.ccTokens[key]
+	if !ok {
+		e = &ccEntry{provider: p.Name}
+		g.ccTokens[key] = e
+	}
+	g.ccLock.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.tok.Valid() && !e.tok.ExpiresWithin(refreshLeeway) {
+		return e.tok, nil
+	}
+
+	qry := url.Values{}
+	qry.Add("grant_type", "client_credentials")
+	if scope != "" {
+		qry.Add("scope", scope)
+	}
+	if audience != "" {
+		qry.Add("audience", audience)
+		if u, err := url.Parse(audience); err == nil && u.IsAbs() {
+			qry.Add("resource", audience)
+		}
+	}
+
+	tok, err := g.tokenRequest(ctx, p, qry)
+	if err == ErrTokenEmpty {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok.AccessToken == "" {
+		return nil, ErrTokenAccessKey
+	}
+
+	// cache only if expiry is known
+	e.tok = nil
+	if !tok.Expiry.IsZero() {
+		e.tok = tok
+	}
+	return tok, nil
+}
@@ -0,0 +1,121 @@
+package goic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrDeviceExpired is error for device code that expired before user authorized
+var ErrDeviceExpired = fmt.Errorf("goic device: device code expired")
+
+// deviceInterval is default polling interval for device token as per RFC8628 (3.2)
+var deviceInterval = 5 * time.Second
+
+// DeviceAuth represents device authorization response as per RFC8628 (3.2)
+// Show the UserCode and VerificationURI (or VerificationURIComplete) to the user.
+type DeviceAuth struct {
+	Expiry                  time.Time `json:"-"`
+	DeviceCode              string    `json:"device_code"`
+	UserCode                string    `json:"user_code"`
+	VerificationURI         string    `json:"verification_uri"`
+	VerificationURIComplete string    `json:"verification_uri_complete,omitempty"`
+	Provider                string    `json:"provider,omitempty"`
+	ExpiresIn               int64     `json:"expires_in"`
+	Interval                int64     `json:"interval,omitempty"`
+}
+
+// DeviceAuth starts the device authorization grant (RFC8628) for given Provider
+// It is meant for CLIs and devices that cannot open browser on same machine.
+func (g *Goic) DeviceAuth(ctx context.Context, p *Provider) (*DeviceAuth, error) {
+	p, ok := g.provider(p.Name)
+	if !ok || !p.CanDeviceAuth() {
+		return nil, ErrProviderSupport
+	}
+
+	qry := url.Values{}
+	qry.Add("client_id", p.clientID)
+	qry.Add("scope", p.Scope)
+
+	body, res, err := g.postForm(ctx, p, p.GetURI("device"), qry, ClientSecretPost)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, oauthError(body, res.StatusCode, p, "device")
+	}
+
+	// verification_url is what some provider like google uses
+	var da struct {
+		DeviceAuth
+		VerificationURL string `json:"verification_url,omitempty"`
+	}
+	if err := json.Unmarshal(body, &da); err != nil {
+		return nil, err
+	}
+	if da.VerificationURI == "" {
+		da.VerificationURI = da.VerificationURL
+	}
+
+	da.Provider = p.Name
+	if da.ExpiresIn > 0 {
+		da.Expiry = time.Now().Add(time.Duration(da.ExpiresIn) * time.Second)
+	}
+	return &da.DeviceAuth, nil
+}
+
+// DeviceToken polls token endpoint until user authorizes the DeviceAuth
+// It honors interval, authorization_pending and slow_down as per RFC8628 (3.5),
+// and the id_token if any is verified the same way as in Authenticate.
+func (g *Goic) DeviceToken(ctx context.Context, da *DeviceAuth) (*Token, error) {
+	p := g.GetProvider(da.Provider)
+	if p == nil {
+		return nil, ErrProviderSupport
+	}
+
+	interval := deviceInterval
+	if da.Interval > 0 {
+		interval = time.Duration(da.Interval) * time.Second
+	}
+
+	qry := url.Values{}
+	qry.Add("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+	qry.Add("device_code", da.DeviceCode)
+
+	for {
+		if !da.Expiry.IsZero() && time.Now().After(da.Expiry) {
+			return nil, ErrDeviceExpired
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		tok, err := g.tokenRequest(ctx, p, qry)
+		switch tok.Err {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += deviceInterval
+			continue
+		case "expired_token":
+			return nil, ErrDeviceExpired
+		}
+
+		if err == ErrTokenEmpty {
+			return tok, nil
+		}
+		if err != nil {
+			return tok, fmt.Errorf("get token: %w", err)
+		}
+		if err := g.verifyToken(p, tok, ""); err != nil {
+			return tok, fmt.Errorf("verify token: %w", err)
+		}
+		return tok, nil
+	}
+}
@@ -0,0 +1,124 @@
+package goic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pollServer gives test server whose token endpoint responds with the scripted bodies in order,
+// repeating the last one, with 400 status for error bodies. It records the time of each poll.
+func pollServer(t *testing.T, bodies ...string) (*httptest.Server, func() []time.Time) {
+	var mu sync.Mutex
+	var polls []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		polls = append(polls, time.Now())
+		body := bodies[min(len(polls), len(bodies))-1]
+		mu.Unlock()
+
+		if strings.Contains(body, `"error"`) {
+			res.WriteHeader(http.StatusBadRequest)
+		}
+		_, _ = res.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Time(nil), polls...)
+	}
+}
+
+// fastPoll shortens the default polling interval for the test
+func fastPoll(t *testing.T) {
+	d := deviceInterval
+	t.Cleanup(func() { deviceInterval = d })
+	deviceInterval = 20 * time.Millisecond
+}
+
+func TestDeviceToken(t *testing.T) {
+	fastPoll(t)
+	pending, slow := `{"error":"authorization_pending"}`, `{"error":"slow_down"}`
+	granted := `{"access_token":"at","token_type":"Bearer","expires_in":60}`
+
+	tests := []struct {
+		name   string
+		bodies []string
+		polls  int
+		err    error // nil for success
+		code   string
+	}{
+		{name: "pending", bodies: []string{pending, pending, granted}, polls: 3},
+		{name: "slow down", bodies: []string{slow, granted}, polls: 2},
+		{name: "expired", bodies: []string{pending, `{"error":"expired_token"}`}, polls: 2, err: ErrDeviceExpired},
+		{name: "denied", bodies: []string{`{"error":"access_denied"}`}, polls: 1, code: "access_denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, polls := pollServer(t, tt.bodies...)
+			g := New("/auth", false)
+			testProvider(g, "idp", &WellKnown{TokenURI: srv.URL})
+
+			tok, err := g.DeviceToken(context.Background(), &DeviceAuth{Provider: "idp", DeviceCode: "dc"})
+			var oe *OAuthError
+			switch {
+			case tt.code != "":
+				if !errors.As(err, &oe) || oe.Code != tt.code {
+					t.Fatalf("expected OAuthError %s, got %v", tt.code, err)
+				}
+			case err != tt.err:
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			case err == nil && tok.AccessToken != "at":
+				t.Fatalf("expected access token, got %+v", tok)
+			}
+
+			got := polls()
+			if len(got) != tt.polls {
+				t.Fatalf("expected %d polls, got %d", tt.polls, len(got))
+			}
+			if tt.name == "slow down" && got[1].Sub(got[0]) < 2*deviceInterval {
+				t.Errorf("expected interval to grow by %s after slow_down, got %s", deviceInterval, got[1].Sub(got[0]))
+			}
+		})
+	}
+}
+
+func TestDeviceTokenExpiry(t *testing.T) {
+	fastPoll(t)
+	srv, polls := pollServer(t, `{"error":"authorization_pending"}`)
+	g := New("/auth", false)
+	testProvider(g, "idp", &WellKnown{TokenURI: srv.URL})
+
+	da := &DeviceAuth{Provider: "idp", DeviceCode: "dc", Expiry: time.Now().Add(3 * deviceInterval)}
+	if _, err := g.DeviceToken(context.Background(), da); err != ErrDeviceExpired {
+		t.Fatalf("expected ErrDeviceExpired past expires_in, got %v", err)
+	}
+	if n := len(polls()); n == 0 || n > 3 {
+		t.Errorf("expected polling to stop at expiry, got %d polls", n)
+	}
+}
+
+func TestDeviceTokenCancel(t *testing.T) {
+	fastPoll(t)
+	srv, polls := pollServer(t, `{"error":"authorization_pending"}`)
+	g := New("/auth", false)
+	testProvider(g, "idp", &WellKnown{TokenURI: srv.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*deviceInterval)
+	defer cancel()
+
+	if _, err := g.DeviceToken(ctx, &DeviceAuth{Provider: "idp", DeviceCode: "dc"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+	if n := len(polls()); n == 0 || n > 5 {
+		t.Errorf("expected polling to stop on cancel, got %d polls", n)
+	}
+}
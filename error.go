@@ -0,0 +1,95 @@
+package goic
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+// authParamRe matches the auth-params of WWW-Authenticate header
+var authParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// OAuthError represents error response from OpenID Provider as per RFC6749 (5.2)
+// Use errors.As to get it from the errors returned by goic.
+type OAuthError struct {
+	Code        string // eg: invalid_grant, access_denied
+	Description string
+	URI         string
+	Provider    string
+	Stage       string // eg: callback, token, userinfo, revoke
+	StatusCode  int    // HTTP status of the response, 0 if not applicable
+}
+
+// Error implements error
+func (e *OAuthError) Error() string {
+	msg := "goic " + e.Stage + ": " + e.Code
+	if e.Code == "" {
+		msg += "unexpected status " + http.StatusText(e.StatusCode)
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// Is makes OAuthError match the equivalent sentinel errors with errors.Is
+func (e *OAuthError) Is(target error) bool {
+	switch target {
+	case ErrRevokeTokenType:
+		return e.Code == "unsupported_token_type"
+	case ErrRevokeUnavailable:
+		return e.Stage == "revoke" && e.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// oauthError gives OAuthError from the error response body of Provider
+func oauthError(body []byte, status int, p *Provider, stage string) *OAuthError {
+	var res struct {
+		Err     string `json:"error"`
+		ErrDesc string `json:"error_description"`
+		ErrURI  string `json:"error_uri"`
+	}
+	_ = json.Unmarshal(body, &res)
+
+	return &OAuthError{
+		Code:        res.Err,
+		Description: res.ErrDesc,
+		URI:         res.ErrURI,
+		Provider:    p.Name,
+		Stage:       stage,
+		StatusCode:  status,
+	}
+}
+
+// queryError gives OAuthError from the error params of redirect back from Provider, nil if none
+func queryError(qry url.Values, p *Provider) *OAuthError {
+	if qry.Get("error") == "" {
+		return nil
+	}
+
+	return &OAuthError{
+		Code:        qry.Get("error"),
+		Description: qry.Get("error_description"),
+		URI:         qry.Get("error_uri"),
+		Provider:    p.Name,
+		Stage:       "callback",
+	}
+}
+
+// bearerError gives OAuthError from WWW-Authenticate header of response as per RFC6750 (3)
+func bearerError(res *http.Response, p *Provider, stage string) *OAuthError {
+	e := &OAuthError{Provider: p.Name, Stage: stage, StatusCode: res.StatusCode}
+	for _, m := range authParamRe.FindAllStringSubmatch(res.Header.Get("WWW-Authenticate"), -1) {
+		switch m[1] {
+		case "error":
+			e.Code = m[2]
+		case "error_description":
+			e.Description = m[2]
+		case "error_uri":
+			e.URI = m[2]
+		}
+	}
+	return e
+}
@@ -0,0 +1,155 @@
+package goic
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrorHandler defines signature for rendering errors of OpenID flow
+// The stage tells where it failed (eg: callback, authenticate), p is nil if Provider is unknown.
+type ErrorHandler func(res http.ResponseWriter, req *http.Request, err error, stage string, p *Provider)
+
+// errorPage is the default html template for errors of OpenID flow
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Sign in failed</title></head>
+<body>
+<h1>Sign in failed</h1>
+<p>{{.Description}}</p>
+<p><small>{{.Code}}</small></p>
+{{if .Restart}}<p><a href="{{.Restart}}">Try again</a></p>{{end}}
+</body>
+</html>
+`))
+
+// verifyErrors are the errors for token that failed verification
+var verifyErrors = []error{
+	ErrTokenEmpty, ErrTokenInvalid, ErrTokenClaims, ErrTokenNonce, ErrTokenSub, ErrTokenAud,
+	ErrTokenAlgo, ErrTokenKey, ErrTokenAccessKey, ErrTokenIssuer, ErrTokenType,
+	jwt.ErrTokenMalformed, jwt.ErrTokenUnverifiable, jwt.ErrTokenSignatureInvalid, jwt.ErrTokenInvalidClaims,
+}
+
+// ErrorHandler sets custom ErrorHandler to render errors of OpenID flow
+// If it is not set, DefaultErrorHandler is used.
+func (g *Goic) ErrorHandler(h ErrorHandler) *Goic {
+	g.errorHandler = h
+	return g
+}
+
+// DefaultErrorHandler renders html error page, or JSON error for API clients
+// Only the provider supplied error and generic messages are shown, internal details are not.
+func DefaultErrorHandler(res http.ResponseWriter, req *http.Request, err error, stage string, p *Provider) {
+	status := ErrorStatus(err)
+	code, desc := errorInfo(err)
+
+	res.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(req) {
+		writeJSON(res, status, map[string]string{"error": code, "error_description": desc})
+		return
+	}
+
+	restart := ""
+	if p != nil && stage != "signed out" {
+		restart = currentURL(req, false)
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(status)
+	_ = errorPage.Execute(res, map[string]string{"Code": code, "Description": desc, "Restart": restart})
+}
+
+// ErrorStatus gives the HTTP status for error of OpenID flow
+func ErrorStatus(err error) int {
+	var oe *OAuthError
+	switch {
+	case errors.Is(err, ErrProviderSupport):
+		return http.StatusNotFound
+	case errors.Is(err, ErrProviderState):
+		return http.StatusBadRequest
+	case errors.As(err, &oe):
+		return oe.status()
+	case isVerifyError(err):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// status gives the HTTP status to respond with for OAuthError
+func (e *OAuthError) status() int {
+	switch e.Code {
+	case "access_denied":
+		return http.StatusForbidden
+	case "login_required", "consent_required", "interaction_required", "account_selection_required":
+		return http.StatusUnauthorized
+	case "temporarily_unavailable":
+		return http.StatusServiceUnavailable
+	case "server_error":
+		return http.StatusBadGateway
+	case "invalid_grant":
+		return http.StatusBadRequest
+	}
+	if e.Stage == "callback" {
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
+
+// errorInfo gives OAuth style error code and description safe to show to user
+func errorInfo(err error) (code, desc string) {
+	var oe *OAuthError
+	switch {
+	case errors.Is(err, ErrProviderSupport):
+		return "invalid_request", "The sign in provider is not supported."
+	case errors.Is(err, ErrProviderState):
+		return "invalid_request", "The sign in request is invalid or has expired, please try again."
+	case errors.As(err, &oe):
+		code, desc = oe.Code, oe.Description
+		if code == "" {
+			code = "server_error"
+		}
+		if desc == "" {
+			desc = "The sign in provider returned an error."
+		}
+		return code, desc
+	case isVerifyError(err):
+		return "invalid_token", "The identity of user could not be verified."
+	}
+	return "server_error", "Something went wrong, please try again later."
+}
+
+// isVerifyError checks if err is due to token that failed verification
+func isVerifyError(err error) bool {
+	for _, e := range verifyErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleError logs err and renders it with ErrorHandler
+func (g *Goic) handleError(res http.ResponseWriter, req *http.Request, err error, stage string, p *Provider) {
+	status, level := ErrorStatus(err), slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{slog.String("stage", stage), slog.Int("status", status), slog.Any("error", err)}
+	if p != nil {
+		attrs = append(attrs, slog.String("provider", p.Name))
+	}
+	if state := req.URL.Query().Get("state"); state != "" {
+		attrs = append(attrs, slog.String("state", state))
+	}
+	g.logger.LogAttrs(req.Context(), level, "goic auth flow failed", attrs...)
+
+	if g.errorHandler != nil {
+		g.errorHandler(res, req, err, stage, p)
+		return
+	}
+	DefaultErrorHandler(res, req, err, stage, p)
+}
@@ -0,0 +1,35 @@
+package goic
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrapErrorHidesPanic(t *testing.T) {
+	g := New("/auth", false)
+	req := httptest.NewRequest("GET", "/auth/idp", nil)
+
+	rec := httptest.NewRecorder()
+	func() {
+		defer g.trapError(rec, req)
+		panic(errors.New("secret internal detail"))
+	}()
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("expected generic 500, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	var stage string
+	g.ErrorHandler(func(res http.ResponseWriter, req *http.Request, err error, s string, p *Provider) {
+		stage = s
+	})
+	func() {
+		defer g.trapError(httptest.NewRecorder(), req)
+		panic("boom")
+	}()
+	if stage != "process" {
+		t.Errorf("expected panic to reach ErrorHandler, got stage %q", stage)
+	}
+}
@@ -0,0 +1,85 @@
+package goic
+
+import (
+	"context"
+	"net/url"
+)
+
+// Token type identifiers as per RFC8693 (3)
+const (
+	TokenTypeAccess  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefresh = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeID      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT     = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchange represents token exchange request as per RFC8693 (2.1)
+type TokenExchange struct {
+	SubjectToken       string
+	SubjectTokenType   string // defaults to TokenTypeAccess
+	ActorToken         string // for delegation, empty for impersonation
+	ActorTokenType     string // defaults to TokenTypeAccess if ActorToken is given
+	RequestedTokenType string
+	Scope              string
+	Audience           []string
+	Resource           []string
+}
+
+// ExchangeToken exchanges a token for another, eg: for a downstream audience (RFC8693)
+// If the issued token is JWT with act claim (delegation), it is exposed in Token.Act.
+// The client is authenticated with ClientAuth of Provider, defaults to ClientSecretPost.
+func (g *Goic) ExchangeToken(ctx context.Context, p *Provider, x *TokenExchange) (*Token, error) {
+	p, ok := g.provider(p.Name)
+	if !ok {
+		return nil, ErrProviderSupport
+	}
+	if x.SubjectToken == "" {
+		return nil, ErrTokenAccessKey
+	}
+
+	qry := url.Values{}
+	qry.Add("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
+	qry.Add("subject_token", x.SubjectToken)
+	qry.Add("subject_token_type", orDefault(x.SubjectTokenType, TokenTypeAccess))
+	if x.ActorToken != "" {
+		qry.Add("actor_token", x.ActorToken)
+		qry.Add("actor_token_type", orDefault(x.ActorTokenType, TokenTypeAccess))
+	}
+	if x.RequestedTokenType != "" {
+		qry.Add("requested_token_type", x.RequestedTokenType)
+	}
+	if x.Scope != "" {
+		qry.Add("scope", x.Scope)
+	}
+	for _, aud := range x.Audience {
+		qry.Add("audience", aud)
+	}
+	for _, res := range x.Resource {
+		qry.Add("resource", res)
+	}
+
+	tok, err := g.tokenRequest(ctx, p, qry)
+	if err == ErrTokenEmpty {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok.AccessToken == "" {
+		return nil, ErrTokenAccessKey
+	}
+
+	// The act claim is informational only, the issued token is for downstream to verify
+	if claims, err := decodeClaims(tok.AccessToken); err == nil {
+		tok.Act, _ = claims["act"].(map[string]any)
+	}
+	return tok, nil
+}
+
+// orDefault gives s if not empty, def otherwise
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -1,5 +1,5 @@
 module github.com/adhocore/goic
 
-go 1.18
+go 1.21
 
 require github.com/golang-jwt/jwt/v5 v5.2.3
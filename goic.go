@@ -1,14 +1,17 @@
 package goic
 
 import (
-	"crypto/ecdsa"
-	"crypto/rsa"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -38,6 +41,9 @@ var (
 	// ErrTokenNonce is error for invalid noce
 	ErrTokenNonce = fmt.Errorf("goic id_token: invalid nonce")
 
+	// ErrTokenSub is error for subject mismatch of refreshed id_token
+	ErrTokenSub = fmt.Errorf("goic id_token: subject mismatch")
+
 	// ErrTokenAud is error for invalid audience
 	ErrTokenAud = fmt.Errorf("goic id_token: invalid audience")
 
@@ -50,6 +56,12 @@ var (
 	// ErrTokenAccessKey is error for invalid access_token
 	ErrTokenAccessKey = fmt.Errorf("goic id_token: invalid access_token")
 
+	// ErrRevokeTokenType is error for token type that provider cannot revoke
+	ErrRevokeTokenType = fmt.Errorf("goic revoke: unsupported_token_type")
+
+	// ErrRevokeUnavailable is error for revocation that provider cannot do now, it can be retried later
+	ErrRevokeUnavailable = fmt.Errorf("goic revoke: service unavailable")
+
 	// ErrSignOutRedir is error for invalid post sign-out redirect uri
 	ErrSignOutRedir = fmt.Errorf("goic sign-out: post redirect uri is invalid")
 )
@@ -69,25 +81,52 @@ type UserCallback func(t *Token, u *User, w http.ResponseWriter, r *http.Request
 type Goic struct {
 	providers    map[string]*Provider
 	userCallback UserCallback
+	session      *SessionOptions
+	introCache   *introCache
+	ccTokens     map[string]*ccEntry
+	cibaAuths    map[string]*CIBAuth
+	logoutJTIs   map[string]time.Time
+	logoutCb     LogoutCallback
+	errorHandler ErrorHandler
+	logger       *slog.Logger
+	observers    []Observer
+	auditSink    AuditSink
+	logouts      map[string]logoutState
+	signOutAllow []string
 	states       map[string]string
+	returns      map[string]returnTo
 	URIPrefix    string
+	stops        map[string]chan struct{}
 	sLock        sync.RWMutex
-	verbose      bool
+	pLock        sync.RWMutex
+	ccLock       sync.Mutex
+	cLock        sync.Mutex
 }
 
 // New gives new GOIC instance
 func New(uri string, verbose bool) *Goic {
 	providers := make(map[string]*Provider)
-	states := make(map[string]string)
-
-	return &Goic{URIPrefix: uri, verbose: verbose, providers: providers, states: states}
+	states, returns := make(map[string]string), make(map[string]returnTo)
+
+	return &Goic{
+		URIPrefix:  uri,
+		logger:     newLogger(os.Stderr, verbose),
+		providers:  providers,
+		stops:      make(map[string]chan struct{}),
+		states:     states,
+		returns:    returns,
+		ccTokens:   make(map[string]*ccEntry),
+		cibaAuths:  make(map[string]*CIBAuth),
+		logoutJTIs: make(map[string]time.Time),
+		logouts:    make(map[string]logoutState),
+	}
 }
 
 // NewProvider registers a new OpenID provider by name
 // It also preloads the well known config and jwks keys
 func (g *Goic) NewProvider(name, uri string, loader ...func() (*WellKnown, error)) *Provider {
-	if p, ok := g.providers[name]; ok {
-		g.logIf("goic provider %s: already set", name)
+	if p, ok := g.provider(name); ok {
+		g.logger.Info("goic provider already set", "provider", name)
 		return p
 	}
 
@@ -105,37 +144,149 @@ func (g *Goic) NewProvider(name, uri string, loader ...func() (*WellKnown, error
 
 // AddProvider adds a Provider to Goic only if it can be discovered
 func (g *Goic) AddProvider(p *Provider, async ...bool) *Provider {
-	if p, ok := g.providers[p.Name]; ok {
-		g.logIf("goic provider %s: already set", p.Name)
-		return p
+	if old, ok := g.provider(p.Name); ok {
+		g.logger.Info("goic provider already set", "provider", p.Name)
+		return old
+	}
+	if err := g.load(p); err != nil {
+		if len(async) == 0 || !async[0] {
+			log.Fatalf("goic provider %s: cannot load well-known configuration: %s", p.Name, err.Error())
+		}
+		return p // return without assigning
+	}
+
+	g.pLock.Lock()
+	defer g.pLock.Unlock()
+	if old, ok := g.providers[p.Name]; ok { // added concurrently
+		return old
+	}
+	g.register(p)
+	return p
+}
+
+// ReplaceProvider atomically replaces the Provider of same name, or adds it if not existent
+// It is useful to rotate credentials at runtime. If the new Provider cannot be discovered,
+// the old one is kept and the error is returned. The cached tokens of old one are dropped.
+func (g *Goic) ReplaceProvider(p *Provider) error {
+	if err := g.load(p); err != nil {
+		return err
+	}
+
+	g.pLock.Lock()
+	if stop, ok := g.stops[p.Name]; ok {
+		close(stop)
+	}
+	g.register(p)
+	g.pLock.Unlock()
+
+	g.forget(p.Name)
+	return nil
+}
+
+// RemoveProvider removes the Provider by name, it gives false if not existent
+func (g *Goic) RemoveProvider(name string) bool {
+	g.pLock.Lock()
+	if _, ok := g.providers[name]; !ok {
+		g.pLock.Unlock()
+		return false
+	}
+	close(g.stops[name])
+	delete(g.providers, name)
+	delete(g.stops, name)
+	g.pLock.Unlock()
+
+	g.forget(name)
+	return true
+}
+
+// Providers gives all the registered Providers sorted by name
+func (g *Goic) Providers() []*Provider {
+	g.pLock.RLock()
+	ps := make([]*Provider, 0, len(g.providers))
+	for _, p := range g.providers {
+		ps = append(ps, p)
 	}
+	g.pLock.RUnlock()
+
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+	return ps
+}
+
+// load discovers the Provider if not yet, it gives the error if that fails
+func (g *Goic) load(p *Provider) error {
 	if p.WellKnowner == nil {
 		p.WellKnowner = p.getWellKnown
 	}
 
-	if !p.discovered {
-		p.wellKnown, p.err = p.WellKnowner()
-		if p.err != nil && (len(async) == 0 || !async[0]) {
-			log.Fatalf("goic provider %s: cannot load well-known configuration: %s", p.Name, p.err.Error())
+	p.mu.RLock()
+	discovered, err := p.discovered, p.err
+	p.mu.RUnlock()
+
+	if !discovered {
+		return g.discover(p)
+	}
+	return err
+}
+
+// register sets the Provider and keeps its well-known in sync until it is removed or replaced
+// The caller must hold the lock.
+func (g *Goic) register(p *Provider) {
+	stop := make(chan struct{})
+	g.providers[p.Name], g.stops[p.Name] = p, stop
+
+	go func() {
+		tick := time.NewTicker(24 * time.Hour)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				_ = g.discover(p)
+			}
 		}
+	}()
+}
+
+// discover loads the well known config of Provider and logs the outcome
+// The fresh config is swapped in only on success, so a failed refresh keeps the last good one.
+func (g *Goic) discover(p *Provider) error {
+	start := time.Now()
+	wk, err := p.WellKnowner()
+	g.observe(context.Background(), StageDiscovery, p.Name, start, err)
+
+	p.mu.Lock()
+	if err == nil || p.wellKnown == nil {
+		p.wellKnown = wk
 	}
-	if p.err != nil {
-		return p // return without assigning
+	p.err, p.discovered = err, err == nil
+	p.mu.Unlock()
+
+	attrs := []slog.Attr{slog.String("provider", p.Name), slog.Duration("duration", time.Since(start))}
+	if err != nil {
+		g.logger.LogAttrs(context.Background(), slog.LevelError, "goic discovery failed", append(attrs, slog.Any("error", err))...)
+		return err
 	}
+	g.logger.LogAttrs(context.Background(), slog.LevelInfo, "goic discovery loaded", attrs...)
+	return nil
+}
 
-	g.providers[p.Name] = p
-	go func() { // Keep wellknown in sync
-		for range time.NewTicker(24 * time.Hour).C {
-			p.discovered = false
-			p.wellKnown, p.err = p.WellKnowner()
+// forget drops the cached client credentials and introspection results of Provider
+func (g *Goic) forget(name string) {
+	g.ccLock.Lock()
+	for k, e := range g.ccTokens {
+		if e.provider == name {
+			delete(g.ccTokens, k)
 		}
-	}()
-	return p
+	}
+	g.ccLock.Unlock()
+
+	g.introCache.forget(name)
 }
 
 // GetProvider returns Provider by name or nil if not existent
 func (g *Goic) GetProvider(name string) *Provider {
-	if p, ok := g.providers[name]; ok {
+	if p, ok := g.provider(name); ok {
 		return p
 	}
 	return nil
@@ -143,13 +294,26 @@ func (g *Goic) GetProvider(name string) *Provider {
 
 // Supports checks if a given provider name is supported
 func (g *Goic) Supports(name string) bool {
-	_, ok := g.providers[name]
+	_, ok := g.provider(name)
 	return ok
 }
 
+// provider gives the Provider by name and whether it exists
+func (g *Goic) provider(name string) (*Provider, bool) {
+	g.pLock.RLock()
+	defer g.pLock.RUnlock()
+
+	p, ok := g.providers[name]
+	return p, ok
+}
+
 // RequestAuth is the starting point of OpenID flow
-func (g *Goic) RequestAuth(p *Provider, state, nonce, redir string, res http.ResponseWriter, req *http.Request) error {
-	if !g.Supports(p.Name) {
+func (g *Goic) RequestAuth(p *Provider, state, nonce, redir string, res http.ResponseWriter, req *http.Request) (err error) {
+	start := time.Now()
+	defer func() { g.observe(req.Context(), StageAuthRedirect, p.Name, start, err) }()
+
+	p, ok := g.provider(p.Name)
+	if !ok {
 		return ErrProviderSupport
 	}
 
@@ -208,11 +372,41 @@ func (g *Goic) checkState(state string) (string, error) {
 	return nonce, nil
 }
 
+// rememberReturn remembers where to return to after login for returnTTL, forgetting expired ones
+func (g *Goic) rememberReturn(state string, rt returnTo) {
+	now := time.Now()
+
+	g.sLock.Lock()
+	defer g.sLock.Unlock()
+
+	for k, v := range g.returns {
+		if now.After(v.expires) {
+			delete(g.returns, k)
+		}
+	}
+	rt.expires = now.Add(returnTTL)
+	g.returns[state] = rt
+}
+
+// popReturn gives and forgets where to return to after login for given state
+func (g *Goic) popReturn(state string) returnTo {
+	g.sLock.Lock()
+	defer g.sLock.Unlock()
+
+	rt, ok := g.returns[state]
+	delete(g.returns, state)
+	if !ok || time.Now().After(rt.expires) {
+		return returnTo{}
+	}
+	return rt
+}
+
 // Authenticate tries to authenticate a user by given code and nonce
 // It is where token is requested and validated
 func (g *Goic) Authenticate(p *Provider, codeOrTok, nonce, redir string) (tok *Token, err error) {
 	tok = &Token{Provider: p.Name}
-	if !g.Supports(p.Name) {
+	p, ok := g.provider(p.Name)
+	if !ok {
 		return tok, ErrProviderSupport
 	}
 
@@ -227,6 +421,7 @@ func (g *Goic) Authenticate(p *Provider, codeOrTok, nonce, redir string) (tok *T
 	if err != nil {
 		return tok, fmt.Errorf("get token: %w", err)
 	}
+
 	if err := g.verifyToken(p, tok, nonce); err != nil {
 		return tok, fmt.Errorf("verify token: %w", err)
 	}
@@ -236,8 +431,6 @@ func (g *Goic) Authenticate(p *Provider, codeOrTok, nonce, redir string) (tok *T
 
 // getToken actually gets token from Provider via wellKnown.TokenURI
 func (g *Goic) getToken(p *Provider, code, redir, grant string) (tok *Token, err error) {
-	tok = &Token{Provider: p.Name}
-
 	qry := url.Values{}
 	qry.Add("grant_type", grant)
 	if grant == "authorization_code" {
@@ -246,77 +439,75 @@ func (g *Goic) getToken(p *Provider, code, redir, grant string) (tok *Token, err
 	} else {
 		qry.Add("refresh_token", code)
 	}
-	qry.Add("client_id", p.clientID)
-	qry.Add("client_secret", p.clientSecret)
 
-	req, err := http.NewRequest("POST", p.GetURI("token"), strings.NewReader(qry.Encode()))
-	if err != nil {
-		return tok, err
+	return g.tokenRequest(context.Background(), p, qry)
+}
+
+// tokenRequest posts the grant form to token endpoint of Provider and parses the Token
+// It is observed as StageToken, except the polls that are pending approval of user.
+// Token without id_token is success here, the callers that need id_token check it.
+func (g *Goic) tokenRequest(ctx context.Context, p *Provider, form url.Values) (*Token, error) {
+	start := time.Now()
+	tok, err := g.postToken(ctx, p, form)
+	if tok.Err != "authorization_pending" && tok.Err != "slow_down" {
+		oerr := err
+		if err == ErrTokenEmpty {
+			oerr = nil
+		}
+		g.observe(ctx, StageToken, p.Name, start, oerr)
 	}
+	return tok, err
+}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	res, err := http.DefaultClient.Do(req)
+// postToken actually posts the grant form to token endpoint of Provider
+func (g *Goic) postToken(ctx context.Context, p *Provider, form url.Values) (*Token, error) {
+	tok := &Token{Provider: p.Name}
+	body, res, err := g.postForm(ctx, p, p.GetURI("token"), form, ClientSecretPost)
 	if err != nil {
 		return tok, err
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return tok, err
+	tok, err = parseToken(body, tok)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		oe := oauthError(body, res.StatusCode, p, "token")
+		tok.Err, tok.ErrDesc, tok.ErrURI = oe.Code, oe.Description, oe.URI
+		return tok, oe
 	}
 
-	return parseToken(body, tok)
+	var oe *OAuthError
+	if errors.As(err, &oe) {
+		oe.StatusCode = res.StatusCode
+	}
+	return tok, err
 }
 
 func parseToken(tokByte []byte, tok *Token) (*Token, error) {
-	if err := json.Unmarshal(tokByte, &tok); err != nil {
+	if err := json.Unmarshal(tokByte, tok); err != nil {
 		return tok, err
 	}
-	if tok.IDToken == "" {
-		return tok, ErrTokenEmpty
+	tok.setExpiry(time.Now())
+	if tok.Err != "" {
+		return tok, &OAuthError{Code: tok.Err, Description: tok.ErrDesc, URI: tok.ErrURI, Provider: tok.Provider, Stage: "token"}
 	}
 
-	if tok.Err != "" {
-		msg := tok.Err
-		if tok.ErrDesc != "" {
-			msg += ": " + tok.ErrDesc
-		}
-		return tok, fmt.Errorf(msg)
+	if tok.IDToken == "" {
+		return tok, ErrTokenEmpty
 	}
 	return tok, nil
 }
 
 // verifyToken checks and verifies authenticity and ownership of Token
 func (g *Goic) verifyToken(p *Provider, tok *Token, nonce string) (err error) {
+	start := time.Now()
+	defer func() { g.observe(context.Background(), StageVerify, p.Name, start, err) }()
+
 	// Data verification
 	if err = tok.VerifyClaims(nonce, p.clientID); err != nil {
 		return err
 	}
 
 	// Signature verification
-	_, err = jwt.ParseWithClaims(tok.IDToken, tok.Claims, func(t *jwt.Token) (any, error) {
-		alg := t.Header["alg"].(string)
-		al2 := alg[0:2]
-		if al2 == "HS" {
-			return []byte(p.clientSecret), nil
-		}
-		if al2 != "RS" && al2 != "ES" {
-			return nil, ErrTokenAlgo
-		}
-
-		for _, key := range p.wellKnown.jwks.Keys {
-			kid := key.Kid == t.Header["kid"]
-			if kid && key.Kty == "EC" && key.Alg == alg {
-				return &ecdsa.PublicKey{X: ParseModulo(key.X), Y: ParseModulo(key.Y), Curve: GetCurve(key.Crv)}, nil
-			}
-			if kid && (key.Kty == "RSA" || key.Alg == alg) {
-				return &rsa.PublicKey{E: ParseExponent(key.E), N: ParseModulo(key.N)}, nil
-			}
-		}
-
-		return nil, ErrTokenKey
-	})
+	_, err = jwt.ParseWithClaims(tok.IDToken, tok.Claims, p.verifyKey)
 
 	return err
 }
@@ -345,52 +536,98 @@ func (g *Goic) MiddlewareFunc(next http.HandlerFunc) http.HandlerFunc {
 
 // process is the actual processor of OpenID flow
 func (g *Goic) process(res http.ResponseWriter, req *http.Request) {
-	defer trapError(res)
+	defer g.trapError(res, req)
 
-	name := req.URL.Path[1+len(g.URIPrefix):]
-	if !g.Supports(name) {
-		g.errorHTML(res, ErrProviderSupport, "", "process")
+	name, action := providerPath(req.URL.Path, g.URIPrefix)
+	p, ok := g.provider(name)
+	if !ok {
+		g.handleError(res, req, ErrProviderSupport, "process", nil)
 		return
 	}
 
-	qry, redir := req.URL.Query(), currentURL(req, false)
-	restart := ` (<a href="` + redir + `">restart</a>)`
-	if msg := qry.Get("error"); msg != "" {
-		if desc := qry.Get("error_description"); desc != "" {
-			msg += ": " + desc
-		}
-		g.errorHTML(res, fmt.Errorf(msg), restart, "callback")
+	switch action {
+	case "":
+	case "ciba":
+		g.cibaNotify(res, req, p)
+		return
+	case "backchannel-logout":
+		g.backchannelLogout(res, req, p)
+		return
+	case "frontchannel-logout":
+		g.frontchannelLogout(res, req, p)
+		return
+	case "signed-out":
+		g.signedOut(res, req, p)
+		return
+	default:
+		g.handleError(res, req, ErrProviderSupport, "process", nil)
+		return
+	}
+
+	qry, redir, start := req.URL.Query(), currentURL(req, false), time.Now()
+	if err := queryError(qry, p); err != nil {
+		g.observe(req.Context(), StageCallback, p.Name, start, err)
+		g.audit(req, EventLogin, p.Name, nil, err)
+		g.UnsetState(qry.Get("state"))
+		g.handleError(res, req, err, "callback", p)
 		return
 	}
 
 	code, state := qry.Get("code"), qry.Get("state")
-	p := g.providers[name]
 	if code == "" {
 		state, nonce := g.initStateAndNonce()
+		rt := returnTo{}
+		if uri := qry.Get("return_to"); safeReturn(uri) {
+			rt.uri = uri
+		}
+		// Linking to current session is only on explicit request from that authenticated session
+		if s, err := g.Session(req); err == nil && qry.Get("link") == "1" {
+			rt.link = s.key()
+		}
+		if rt != (returnTo{}) {
+			g.rememberReturn(state, rt)
+		}
 		if err := g.RequestAuth(p, state, nonce, redir, res, req); err != nil {
-			g.errorHTML(res, err, restart, "request auth")
+			g.handleError(res, req, err, "request auth", p)
 		}
 		return
 	}
 
 	nonce, err := g.checkState(state)
 	if err != nil {
-		g.errorHTML(res, err, restart, "checkState")
+		g.observe(req.Context(), StageCallback, p.Name, start, err)
+		g.audit(req, EventLogin, p.Name, nil, err)
+		g.handleError(res, req, err, "check state", p)
 		return
 	}
+	rt := g.popReturn(state)
+	if rt.uri != "" {
+		req = req.WithContext(context.WithValue(req.Context(), returnKey, rt.uri))
+	}
 
 	tok, err := g.Authenticate(p, code, nonce, redir)
+	g.observe(req.Context(), StageCallback, p.Name, start, err)
+	g.audit(req, EventLogin, p.Name, tok, err)
 	if err != nil {
-		g.errorHTML(res, err, restart, "authenticate")
+		g.handleError(res, req, err, "authenticate", p)
 		return
 	}
 
-	if g.userCallback == nil {
+	if g.userCallback == nil && g.session == nil {
 		_, _ = res.Write([]byte("OK, the auth flow is complete. However, backend is yet to request userinfo"))
 		return
 	}
 
-	g.userCallback(tok, g.UserInfo(tok), res, req)
+	user := g.UserInfo(tok)
+	if g.session != nil && user.Error == nil {
+		g.newSession(tok, user, rt.link, res, req)
+	}
+	if g.userCallback == nil {
+		http.Redirect(res, req, ReturnTo(req), http.StatusFound)
+		return
+	}
+
+	g.userCallback(tok, user, res, req)
 }
 
 // initStateAndNonce inits one time state and nonce
@@ -420,8 +657,17 @@ func (g *Goic) UserCallback(cb UserCallback) *Goic {
 // UserInfo loads user info when given a Token
 // Error if any is embedded inside User.Error
 func (g *Goic) UserInfo(tok *Token) *User {
+	start := time.Now()
+	user := g.userInfo(tok)
+	g.observe(context.Background(), StageUserInfo, tok.Provider, start, user.Error)
+	return user
+}
+
+// userInfo actually loads user info from Provider via wellKnown.UserInfoURI
+func (g *Goic) userInfo(tok *Token) *User {
 	user := &User{}
-	if !g.Supports(tok.Provider) {
+	p, ok := g.provider(tok.Provider)
+	if !ok {
 		return user.withError(ErrProviderSupport)
 	}
 
@@ -429,7 +675,6 @@ func (g *Goic) UserInfo(tok *Token) *User {
 		return user.withError(ErrTokenAccessKey)
 	}
 
-	p := g.providers[tok.Provider]
 	if p.GetURI("userinfo") == "" {
 		return user.FromClaims(tok.Claims)
 	}
@@ -453,6 +698,12 @@ func (g *Goic) UserInfo(tok *Token) *User {
 		return user.withError(err)
 	}
 
+	if res.StatusCode != http.StatusOK {
+		if res.Header.Get("WWW-Authenticate") != "" {
+			return user.withError(bearerError(res, p, "userinfo"))
+		}
+		return user.withError(oauthError(body, res.StatusCode, p, "userinfo"))
+	}
 	if err := json.Unmarshal(body, &user); err != nil {
 		return user.withError(err)
 	}
@@ -461,62 +712,158 @@ func (g *Goic) UserInfo(tok *Token) *User {
 }
 
 // RefreshToken gets new access token using the refresh token
-func (g *Goic) RefreshToken(tok *Token) (*Token, error) {
-	name := tok.Provider
-	if !g.Supports(name) {
+// If the provider does not rotate refresh token, the old one is carried over.
+// If the provider returns new id_token, it is verified and must be of same subject.
+func (g *Goic) RefreshToken(tok *Token) (t *Token, err error) {
+	start := time.Now()
+	defer func() {
+		g.observe(context.Background(), StageRefresh, tok.Provider, start, err)
+		g.audit(nil, EventRefresh, tok.Provider, tok, err)
+	}()
+
+	p, ok := g.provider(tok.Provider)
+	if !ok {
 		return nil, ErrProviderSupport
 	}
 	if tok.RefreshToken == "" {
 		return nil, ErrRefreshTokenInvalid
 	}
 
-	p := g.providers[name]
-	t, err := g.getToken(p, tok.RefreshToken, "", "refresh_token")
+	t, err = g.getToken(p, tok.RefreshToken, "", "refresh_token")
 	if err == ErrTokenEmpty {
 		err = nil
+	} else if err == nil {
+		err = g.verifyRefreshed(p, tok, t)
+	}
+	if err != nil {
+		return t, err
+	}
+	if t.AccessToken == "" {
+		return t, ErrTokenAccessKey
+	}
+
+	if t.RefreshToken == "" {
+		t.RefreshToken = tok.RefreshToken
+	}
+	if t.IDToken == "" {
+		t.IDToken, t.Claims = tok.IDToken, tok.Claims
+	}
+	if t.Scope == "" {
+		t.Scope = tok.Scope
+	}
+	return t, nil
+}
+
+// verifyRefreshed verifies id_token of refreshed Token t against the original Token
+func (g *Goic) verifyRefreshed(p *Provider, old, t *Token) error {
+	prev := old.Claims
+	if prev == nil && old.IDToken != "" {
+		prev, _ = decodeClaims(old.IDToken)
+	}
+
+	// nonce if present must be same as original, skip check if original is unknown
+	nonce := claimString(prev, "nonce")
+	if nonce == "" {
+		if cur, err := decodeClaims(t.IDToken); err == nil {
+			nonce = claimString(cur, "nonce")
+		}
+	}
+	if err := g.verifyToken(p, t, nonce); err != nil {
+		return fmt.Errorf("verify token: %w", err)
 	}
 
-	return t, err
+	if sub := claimString(prev, "sub"); sub != "" && sub != claimString(t.Claims, "sub") {
+		return ErrTokenSub
+	}
+	return nil
 }
 
-// SignOut signs out the Token from OpenID Provider and then redirects to given URI
-// Redirect URI must be preconfigured in OpenID Provider already
+// SignOut clears the local session, signs out the Token from OpenID Provider and then redirects to given URI
+// The URI must be local path or allowed by AllowSignOutRedirect. The Provider redirects back to
+// <URIPrefix>/<name>/signed-out first which must be preconfigured in OpenID Provider already.
 func (g *Goic) SignOut(tok *Token, redir string, res http.ResponseWriter, req *http.Request) error {
-	if redir != "" {
-		if _, err := url.Parse(redir); err != nil {
-			return ErrSignOutRedir
-		}
+	uri, err := g.SignOutURL(tok, redir, "", req)
+	g.audit(req, EventLogout, tok.Provider, tok, err)
+	if err != nil {
+		return err
 	}
 
-	p, ok := g.providers[tok.Provider]
+	g.ClearSession(res, req)
+	http.Redirect(res, req, uri, http.StatusFound)
+	return nil
+}
+
+// SignOutURL gives the full RP-initiated logout URL for the Provider of Token
+// The hint if given is sent as logout_hint, eg: email of the user.
+func (g *Goic) SignOutURL(tok *Token, redir, hint string, req *http.Request) (string, error) {
+	if redir != "" && !g.allowSignOut(redir) {
+		return "", ErrSignOutRedir
+	}
+	return g.signOutURL(tok, redir, hint, nil, req)
+}
+
+// signOutURL gives the logout URL for Token, and the next Tokens to sign out after it
+func (g *Goic) signOutURL(tok *Token, redir, hint string, next []*Token, req *http.Request) (string, error) {
+	if len(next) > 0 && redir == "" {
+		redir = "/"
+	}
+
+	p, ok := g.provider(tok.Provider)
 	if !ok || !p.CanSignOut() {
-		return ErrProviderSupport
+		return "", ErrProviderSupport
 	}
 
 	redirect, err := http.NewRequest("GET", p.GetURI("signout"), nil)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	tk, qry := tok.AccessToken, redirect.URL.Query()
-	if tk == "" && tok.RefreshToken != "" {
-		tk = tok.RefreshToken
+	qry := redirect.URL.Query()
+	qry.Add("client_id", p.clientID)
+	if tok.IDToken != "" {
+		qry.Add("id_token_hint", tok.IDToken)
 	}
-	if tk != "" {
-		qry.Add("id_token_hint", tk)
+	if hint != "" {
+		qry.Add("logout_hint", hint)
 	}
 	if redir != "" {
-		qry.Add("post_logout_redirect_uri", redir)
+		state := randomID()
+		g.rememberLogout(state, logoutState{provider: p.Name, redir: redir, next: next})
+
+		qry.Add("post_logout_redirect_uri", baseURL(req)+g.URIPrefix+"/"+p.Name+"/signed-out")
+		qry.Add("state", state)
 	}
 
 	redirect.URL.RawQuery = qry.Encode()
-	http.Redirect(res, req, redirect.URL.String(), http.StatusFound)
-	return nil
+	return redirect.URL.String(), nil
+}
+
+// AllowSignOutRedirect allows given absolute URIs as redirect target after sign out
+// Local paths like /home are always allowed.
+func (g *Goic) AllowSignOutRedirect(uris ...string) *Goic {
+	g.signOutAllow = append(g.signOutAllow, uris...)
+	return g
+}
+
+// allowSignOut checks if redirect to uri after sign out is allowed
+func (g *Goic) allowSignOut(uri string) bool {
+	if safeReturn(uri) {
+		return true
+	}
+	for _, v := range g.signOutAllow {
+		if v == uri {
+			return true
+		}
+	}
+	return false
 }
 
 // RevokeToken revokes a Token so that it is no longer usable
-func (g *Goic) RevokeToken(tok *Token) error {
-	p, ok := g.providers[tok.Provider]
+// It revokes the access token, or the refresh token if there is no access token.
+func (g *Goic) RevokeToken(tok *Token) (err error) {
+	defer func() { g.audit(nil, EventRevoke, tok.Provider, tok, err) }()
+
+	p, ok := g.provider(tok.Provider)
 	if !ok || !p.CanRevoke() {
 		return ErrProviderSupport
 	}
@@ -529,61 +876,88 @@ func (g *Goic) RevokeToken(tok *Token) error {
 		return ErrTokenAccessKey
 	}
 
-	qry := url.Values{}
-	qry.Add("token", tk)
-	qry.Add("token_type_hint", hint)
+	return g.revoke(p, tk, hint)
+}
 
-	req, err := http.NewRequest("POST", p.GetURI("revoke"), strings.NewReader(qry.Encode()))
-	if err != nil {
-		return err
-	}
+// RevokeTokens revokes both refresh token and access token of a Token
+// The refresh token is revoked first, so no new access token can be obtained.
+// It tries to revoke both even if one fails, and gives the first error.
+func (g *Goic) RevokeTokens(tok *Token) (err error) {
+	defer func() { g.audit(nil, EventRevoke, tok.Provider, tok, err) }()
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Authorization", p.AuthBasicHeader())
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	p, ok := g.provider(tok.Provider)
+	if !ok || !p.CanRevoke() {
+		return ErrProviderSupport
 	}
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return err
+	if tok.AccessToken == "" && tok.RefreshToken == "" {
+		return ErrTokenAccessKey
 	}
 
-	var revoke map[string]any
-	if err := json.Unmarshal(body, &revoke); err != nil {
-		return err
+	if tok.RefreshToken != "" {
+		err = g.revoke(p, tok.RefreshToken, "refresh_token")
 	}
-	if e, ok := revoke["error"].(map[string]string); ok {
-		if msg, ok := e["message"]; ok {
-			return fmt.Errorf(msg)
+	if tok.AccessToken != "" {
+		if e := g.revoke(p, tok.AccessToken, "access_token"); err == nil {
+			err = e
 		}
 	}
-	return nil
+	return err
 }
 
-// logIf logs if verbose is set
-func (g *Goic) logIf(s string, v ...any) {
-	if g.verbose {
-		log.Printf(s, v...)
+// revoke revokes the token of given type hint as per RFC7009
+func (g *Goic) revoke(p *Provider, tk, hint string) (err error) {
+	start := time.Now()
+	defer func() { g.observe(context.Background(), StageRevoke, p.Name, start, err) }()
+
+	qry := url.Values{}
+	qry.Add("token", tk)
+	qry.Add("token_type_hint", hint)
+
+	body, res, err := g.postForm(context.Background(), p, p.GetURI("revoke"), qry, ClientSecretBasic)
+	if err != nil {
+		return err
+	}
+
+	// The content of success response is ignored as per RFC7009 (2.2)
+	if res.StatusCode == http.StatusOK {
+		return nil
 	}
+	return oauthError(body, res.StatusCode, p, "revoke")
 }
 
-// errorHTML shows error page with html like text
-func (g *Goic) errorHTML(res http.ResponseWriter, err error, h, label string) {
-	g.logIf("[err] %s: %v\n", label, err)
+// postForm posts form to Provider endpoint uri with client authentication
+// It gives the response body and the response whose body is already closed.
+func (g *Goic) postForm(ctx context.Context, p *Provider, uri string, form url.Values, auth ClientAuthFunc) ([]byte, *http.Response, error) {
+	h := http.Header{}
+	p.authClient(form, h, auth)
 
-	res.Header().Set("Content-Type", "text/html; charset=utf-8")
-	res.Header().Set("X-Content-Type-Options", "nosniff")
-	res.WriteHeader(http.StatusInternalServerError)
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, nil, err
+	}
 
-	_, _ = res.Write([]byte(err.Error() + h))
+	req.Header = h
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	start := time.Now()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		g.logger.LogAttrs(ctx, slog.LevelWarn, "goic provider request failed", slog.String("provider", p.Name),
+			slog.String("uri", uri), slog.Duration("duration", time.Since(start)), slog.Any("error", err))
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	g.logger.LogAttrs(ctx, slog.LevelDebug, "goic provider request", slog.String("provider", p.Name),
+		slog.String("uri", uri), slog.Int("status", res.StatusCode), slog.Duration("duration", time.Since(start)))
+
+	body, err := io.ReadAll(res.Body)
+	return body, res, err
 }
 
 // UnsetState unsets state from memory
 func (g *Goic) UnsetState(s string) {
 	g.sLock.Lock()
 	delete(g.states, s)
+	delete(g.returns, s)
 	g.sLock.Unlock()
 }
@@ -0,0 +1,181 @@
+package goic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIssuer is the issuer of test Provider
+const testIssuer = "https://idp.test"
+
+// testRSA is the key that test Provider signs tokens with
+var testRSA, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// testProvider adds Provider whose well-known is stubbed, with jwks of testRSA
+func testProvider(g *Goic, name string, wk *WellKnown) *Provider {
+	return g.AddProvider(stubProvider(name, wk).WithCredential("client", "secret"))
+}
+
+// stubProvider gives Provider whose well-known is stubbed, with jwks of testRSA
+func stubProvider(name string, wk *WellKnown) *Provider {
+	if wk == nil {
+		wk = &WellKnown{}
+	}
+	wk.Issuer = testIssuer
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","alg":"RS256","kid":"k1","e":"AQAB","n":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(testRSA.N.Bytes()))
+	_ = json.Unmarshal([]byte(jwks), &wk.jwks)
+
+	return &Provider{Name: name, URL: testIssuer, WellKnowner: func() (*WellKnown, error) { return wk, nil }}
+}
+
+// signToken signs claims with testRSA
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = "k1"
+
+	raw, err := tok.SignedString(testRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// tokenServer gives test server whose token endpoint responds with given status and body
+func tokenServer(t *testing.T, status int, body string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(status)
+		_, _ = res.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRefreshTokenStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		code   string
+	}{
+		{status: http.StatusInternalServerError, body: `{}`},
+		{status: http.StatusBadGateway, body: `<html>bad gateway</html>`},
+		{status: http.StatusBadRequest, body: `{"error":"invalid_grant"}`, code: "invalid_grant"},
+	}
+
+	for _, tt := range tests {
+		srv := tokenServer(t, tt.status, tt.body)
+		g := New("/auth", false)
+		testProvider(g, "idp", &WellKnown{TokenURI: srv.URL})
+
+		tok, err := g.RefreshToken(&Token{Provider: "idp", RefreshToken: "r"})
+		var oe *OAuthError
+		if !errors.As(err, &oe) || oe.StatusCode != tt.status || oe.Code != tt.code {
+			t.Errorf("%d %s: expected OAuthError with status, got %v", tt.status, tt.body, err)
+		}
+		if tok != nil && tok.AccessToken != "" {
+			t.Errorf("%d: expected no access token", tt.status)
+		}
+	}
+}
+
+func TestRefreshTokenEmpty(t *testing.T) {
+	srv := tokenServer(t, http.StatusOK, `{}`)
+	g := New("/auth", false)
+	testProvider(g, "idp", &WellKnown{TokenURI: srv.URL})
+
+	if _, err := g.RefreshToken(&Token{Provider: "idp", RefreshToken: "r"}); err != ErrTokenAccessKey {
+		t.Errorf("expected ErrTokenAccessKey for response without access token, got %v", err)
+	}
+}
+
+func TestReplaceProvider(t *testing.T) {
+	var secrets []string
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		secrets = append(secrets, req.PostFormValue("client_secret"))
+		_, _ = res.Write([]byte(`{"access_token":"at","token_type":"Bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	g := New("/auth", false)
+	old := testProvider(g, "idp", &WellKnown{TokenURI: srv.URL})
+	if _, err := g.ClientCredentials(context.Background(), old, nil, ""); err != nil {
+		t.Fatalf("client credentials: %v", err)
+	}
+
+	fail := &Provider{Name: "idp", WellKnowner: func() (*WellKnown, error) { return nil, errors.New("down") }}
+	if err := g.ReplaceProvider(fail.WithCredential("client", "bad")); err == nil {
+		t.Fatal("expected replace with undiscoverable Provider to fail")
+	}
+	if g.GetProvider("idp") != old {
+		t.Fatal("expected old Provider to be kept")
+	}
+
+	p := &Provider{Name: "idp", WellKnowner: func() (*WellKnown, error) { return &WellKnown{TokenURI: srv.URL}, nil }}
+	if err := g.ReplaceProvider(p.WithCredential("client", "rotated")); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if _, err := g.ClientCredentials(context.Background(), old, nil, ""); err != nil {
+		t.Fatalf("client credentials: %v", err)
+	}
+
+	if want := "secret rotated"; fmt.Sprint(secrets) != "["+want+"]" {
+		t.Errorf("expected secrets %q, got %v", want, secrets)
+	}
+}
+
+func TestDiscoverConcurrent(t *testing.T) {
+	g := New("/auth", false)
+	p := testProvider(g, "idp", &WellKnown{TokenURI: "https://idp.test/token"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); _ = g.discover(p) }()
+		go func() {
+			defer wg.Done()
+			if uri := p.GetURI("token"); uri != "https://idp.test/token" {
+				t.Errorf("expected token uri, got %q", uri)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParseTokenExpiresIn(t *testing.T) {
+	for _, body := range []string{
+		`{"id_token":"x","expires_in":3599}`,
+		`{"id_token":"x","expires_in":"3599"}`,
+	} {
+		tok, err := parseToken([]byte(body), &Token{})
+		if err != nil {
+			t.Errorf("%s: %v", body, err)
+			continue
+		}
+		if tok.ExpiresIn != 3599 || tok.Expiry.IsZero() {
+			t.Errorf("%s: expected expiry from expires_in, got %d %v", body, tok.ExpiresIn, tok.Expiry)
+		}
+	}
+
+	if _, err := parseToken([]byte(`{"id_token":"x","expires_in":"soon"}`), &Token{}); err == nil {
+		t.Error("expected invalid expires_in to fail")
+	}
+}
+
+func TestUserFromClaims(t *testing.T) {
+	u := (&User{}).FromClaims(jwt.MapClaims{"sub": "user", "email": "u@v.w", "name": 1})
+	if u.Subject != "user" || u.Email != "u@v.w" || u.Name != "" {
+		t.Errorf("expected present string claims only, got %+v", u)
+	}
+}
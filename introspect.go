@@ -0,0 +1,192 @@
+package goic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Introspection represents token introspection response as per RFC7662
+type Introspection struct {
+	Active    bool             `json:"active"`
+	Scope     string           `json:"scope,omitempty"`
+	ClientID  string           `json:"client_id,omitempty"`
+	Username  string           `json:"username,omitempty"`
+	TokenType string           `json:"token_type,omitempty"`
+	Subject   string           `json:"sub,omitempty"`
+	Issuer    string           `json:"iss,omitempty"`
+	JTI       string           `json:"jti,omitempty"`
+	Audience  jwt.ClaimStrings `json:"aud,omitempty"`
+	Exp       int64            `json:"exp,omitempty"`
+	Iat       int64            `json:"iat,omitempty"`
+	Nbf       int64            `json:"nbf,omitempty"`
+}
+
+// introCache caches active introspection results until token expiry or ttl
+type introCache struct {
+	entries map[string]introEntry
+	mu      sync.Mutex
+	ttl     time.Duration
+}
+
+type introEntry struct {
+	until    time.Time
+	res      Introspection // kept by value so callers cannot change it
+	provider string
+}
+
+// WithIntrospectCache enables caching of active introspection results for at most ttl
+// A result is never cached beyond the expiry (exp) of the token.
+func (g *Goic) WithIntrospectCache(ttl time.Duration) *Goic {
+	g.introCache = &introCache{entries: make(map[string]introEntry), ttl: ttl}
+	return g
+}
+
+// Introspect checks the state of access token (or refresh token if no access token) of Token
+// with introspection endpoint of its Provider as per RFC7662. The client is authenticated
+// with ClientAuth of Provider, defaults to ClientSecretBasic.
+func (g *Goic) Introspect(ctx context.Context, tok *Token) (*Introspection, error) {
+	p, ok := g.provider(tok.Provider)
+	if !ok || !p.CanIntrospect() {
+		return nil, ErrProviderSupport
+	}
+
+	tk, hint := tok.AccessToken, "access_token"
+	if tk == "" && tok.RefreshToken != "" {
+		tk, hint = tok.RefreshToken, "refresh_token"
+	}
+	return g.introspect(ctx, p, tk, hint)
+}
+
+// IntrospectToken checks the state of raw token with introspection endpoint of Provider by name
+// It is for resource servers that receive opaque bearer token, the hint is optional.
+func (g *Goic) IntrospectToken(ctx context.Context, provider, raw, hint string) (*Introspection, error) {
+	p, ok := g.provider(provider)
+	if !ok || !p.CanIntrospect() {
+		return nil, ErrProviderSupport
+	}
+	return g.introspect(ctx, p, raw, hint)
+}
+
+// introspect actually posts the token to introspection endpoint, or gives the cached result
+func (g *Goic) introspect(ctx context.Context, p *Provider, tk, hint string) (*Introspection, error) {
+	if tk == "" {
+		return nil, ErrTokenAccessKey
+	}
+
+	key := cacheKey(p.Name, tk)
+	if res := g.introCache.get(key); res != nil {
+		return res, nil
+	}
+
+	qry := url.Values{}
+	qry.Add("token", tk)
+	if hint != "" {
+		qry.Add("token_type_hint", hint)
+	}
+
+	body, res, err := g.postForm(ctx, p, p.GetURI("introspect"), qry, ClientSecretBasic)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, oauthError(body, res.StatusCode, p, "introspect")
+	}
+
+	intro := &Introspection{}
+	if err := json.Unmarshal(body, intro); err != nil {
+		return nil, err
+	}
+
+	g.introCache.put(key, p.Name, intro)
+	return intro, nil
+}
+
+// get gives cached result by key if not yet stale
+func (c *introCache) get(key string) *Introspection {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(e.until) {
+		delete(c.entries, key)
+		return nil
+	}
+	res := e.res.clone()
+	return &res
+}
+
+// put caches the result of Provider by key if it is active
+func (c *introCache) put(key, provider string, res *Introspection) {
+	if c == nil || !res.Active {
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(c.ttl)
+	if res.Exp > 0 {
+		if exp := time.Unix(res.Exp, 0); exp.Before(until) {
+			until = exp
+		}
+	}
+	if !until.After(now) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.entries {
+		if now.After(e.until) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = introEntry{until: until, res: res.clone(), provider: provider}
+}
+
+// forget drops the cached results of Provider
+func (c *introCache) forget(provider string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.entries {
+		if e.provider == provider {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// clone gives a copy of Introspection that shares nothing with it
+func (r *Introspection) clone() Introspection {
+	cp := *r
+	cp.Audience = append(jwt.ClaimStrings(nil), r.Audience...)
+	return cp
+}
+
+// cacheKey gives a hashed cache key so raw tokens are not kept as map keys
+func cacheKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
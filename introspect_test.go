@@ -0,0 +1,87 @@
+package goic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// introspectGoic gives Goic with cache ttl whose introspection endpoint responds with body
+func introspectGoic(t *testing.T, ttl time.Duration, body string) (*Goic, *int32) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if req.PostFormValue("token") == "" {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = res.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	g := New("/auth", false).WithIntrospectCache(ttl)
+	testProvider(g, "idp", &WellKnown{IntrospectURI: srv.URL})
+	return g, &hits
+}
+
+func TestIntrospectCache(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	g, hits := introspectGoic(t, time.Minute, fmt.Sprintf(`{"active":true,"scope":"read","aud":["api"],"exp":%d}`, exp))
+
+	res, err := g.IntrospectToken(context.Background(), "idp", "opaque", "access_token")
+	if err != nil || !res.Active || res.Scope != "read" {
+		t.Fatalf("expected active result, got %+v %v", res, err)
+	}
+	res.Scope, res.Audience[0] = "admin", "other"
+
+	res, err = g.Introspect(context.Background(), &Token{Provider: "idp", AccessToken: "opaque"})
+	if err != nil || *hits != 1 {
+		t.Fatalf("expected cache hit, got %d hits %v", *hits, err)
+	}
+	if res.Scope != "read" || res.Audience[0] != "api" {
+		t.Errorf("expected cached result to be unaffected by caller, got %+v", res)
+	}
+}
+
+func TestIntrospectNotCached(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		body string
+	}{
+		{name: "inactive", ttl: time.Minute, body: `{"active":false}`},
+		{name: "expired", ttl: time.Minute, body: fmt.Sprintf(`{"active":true,"exp":%d}`, time.Now().Add(-time.Second).Unix())},
+		{name: "ttl", ttl: time.Nanosecond, body: `{"active":true}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, hits := introspectGoic(t, tt.ttl, tt.body)
+			for i := 0; i < 2; i++ {
+				if _, err := g.IntrospectToken(context.Background(), "idp", "opaque", ""); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if *hits != 2 {
+				t.Errorf("expected no cache hit, got %d hits", *hits)
+			}
+		})
+	}
+}
+
+func TestIntrospectUnsupported(t *testing.T) {
+	g := New("/auth", false)
+	testProvider(g, "idp", nil)
+
+	if _, err := g.IntrospectToken(context.Background(), "idp", "opaque", ""); err != ErrProviderSupport {
+		t.Errorf("expected ErrProviderSupport without introspection endpoint, got %v", err)
+	}
+	if _, err := g.IntrospectToken(context.Background(), "none", "opaque", ""); err != ErrProviderSupport {
+		t.Errorf("expected ErrProviderSupport for unknown provider, got %v", err)
+	}
+}
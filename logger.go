@@ -0,0 +1,117 @@
+package goic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redacted is the value logged in place of secrets
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are the log attribute keys whose values are always redacted
+// Keys containing token or secret are also redacted.
+var sensitiveKeys = map[string]bool{
+	"code": true, "nonce": true, "password": true, "authorization": true, "cookie": true,
+	"assertion": true, "auth_req_id": true, "device_code": true, "user_code": true,
+}
+
+// jwtRe matches JWT like values so that they are redacted wherever they appear
+var jwtRe = regexp.MustCompile(`eyJ[\w-]*\.[\w-]*\.[\w-]*`)
+
+// WithLogger sets the structured logger, secrets and tokens are redacted before they reach it
+func (g *Goic) WithLogger(l *slog.Logger) *Goic {
+	g.logger = slog.New(&redactHandler{l.Handler()})
+	return g
+}
+
+// Logger gives the redacting structured logger used by Goic
+func (g *Goic) Logger() *slog.Logger {
+	return g.logger
+}
+
+// newLogger gives default text logger to w, at debug level if verbose or warn level otherwise
+func newLogger(w io.Writer, verbose bool) *slog.Logger {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelDebug
+	}
+	return slog.New(&redactHandler{slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// redactHandler is slog.Handler that redacts sensitive attributes before passing to next handler
+type redactHandler struct {
+	next slog.Handler
+}
+
+// Enabled implements slog.Handler
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redact(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+// WithAttrs implements slog.Handler
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = redact(a)
+	}
+	return &redactHandler{h.next.WithAttrs(out)}
+}
+
+// WithGroup implements slog.Handler
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{h.next.WithGroup(name)}
+}
+
+// redact gives the Attr with sensitive value redacted, and state value hashed
+func redact(a slog.Attr) slog.Attr {
+	v, key := a.Value.Resolve(), strings.ToLower(a.Key)
+	switch {
+	case v.Kind() == slog.KindGroup:
+		group := v.Group()
+		out := make([]any, len(group))
+		for i, ga := range group {
+			out[i] = redact(ga)
+		}
+		return slog.Group(a.Key, out...)
+	case key == "state":
+		return slog.String(a.Key, hashValue(v.String()))
+	case sensitiveKeys[key] || strings.Contains(key, "token") || strings.Contains(key, "secret"):
+		return slog.String(a.Key, redacted)
+	case v.Kind() == slog.KindString:
+		return slog.String(a.Key, redactString(v.String()))
+	case v.Kind() == slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redactString redacts JWT like values in s
+func redactString(s string) string {
+	return jwtRe.ReplaceAllString(s, redacted)
+}
+
+// hashValue gives short sha256 hash of s so it can be correlated without being revealed
+func hashValue(s string) string {
+	if s == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,57 @@
+package goic
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggerRedacts(t *testing.T) {
+	jwt1, jwt2 := "eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ1In0.c2ln", "eyJ0eXAiOiJKV1QifQ.eyJpc3MiOiJpIn0.c2lnMg"
+	secrets := []string{
+		"at-secret-1", "rt-secret-2", "cs-secret-3", "code-secret-4", "state-secret-5",
+		"pw-secret-6", "bearer-secret-7", "idt-secret-8", "dc-secret-9", jwt1, jwt2,
+	}
+
+	var buf bytes.Buffer
+	l := newLogger(&buf, true)
+	l.Info("got token "+jwt1,
+		"access_token", "at-secret-1",
+		"client_secret", "cs-secret-3",
+		"code", "code-secret-4",
+		"state", "state-secret-5",
+		"error", errors.New("verify "+jwt2+" failed"),
+		slog.Group("req", "refresh_token", "rt-secret-2", slog.Group("headers", "Authorization", "Bearer bearer-secret-7")),
+		"provider", "idp",
+	)
+	l.With("id_token", "idt-secret-8").WithGroup("device").Debug("poll", "device_code", "dc-secret-9", "Password", "pw-secret-6")
+
+	out := buf.String()
+	for _, s := range secrets {
+		if strings.Contains(out, s) {
+			t.Errorf("expected %q to be redacted in:\n%s", s, out)
+		}
+	}
+	for _, s := range []string{"provider=idp", "state=" + hashValue("state-secret-5"), "msg=\"got token " + redacted + "\"", "req.headers.Authorization=" + redacted} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %q in:\n%s", s, out)
+		}
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	newLogger(&buf, false).Info("discovered")
+	if buf.Len() != 0 {
+		t.Errorf("expected info to be dropped when not verbose, got %s", buf.String())
+	}
+
+	var sink bytes.Buffer
+	g := New("/auth", false).WithLogger(slog.New(slog.NewJSONHandler(&sink, nil)))
+	g.Logger().Warn("custom", "client_secret", "cs-secret")
+	if strings.Contains(sink.String(), "cs-secret") || !strings.Contains(sink.String(), `"client_secret":"`+redacted+`"`) {
+		t.Errorf("expected injected logger to be redacted too, got %s", sink.String())
+	}
+}
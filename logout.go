@@ -0,0 +1,327 @@
+package goic
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrLogoutToken is error for invalid logout_token
+	ErrLogoutToken = fmt.Errorf("goic logout_token: invalid logout_token")
+
+	// ErrLogoutReplay is error for logout_token that was already used
+	ErrLogoutReplay = fmt.Errorf("goic logout_token: token already used")
+)
+
+// backchannelEvent is the event that logout_token must have as per OpenID back-channel logout (2.4)
+const backchannelEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// logoutJTITTL is how long jti of logout_token without exp is remembered for replay check
+var logoutJTITTL = time.Hour
+
+// logoutTTL is how long the state of RP-initiated logout is kept for Provider to redirect back
+var logoutTTL = 15 * time.Minute
+
+// logoutState is the state of RP-initiated logout to resume after Provider redirects back
+type logoutState struct {
+	provider string
+	redir    string
+	next     []*Token // to sign out from next, for single logout
+	expires  time.Time
+}
+
+// LogoutResult is the outcome of single logout for a Provider
+type LogoutResult struct {
+	Err       error // error of revocation if any
+	Provider  string
+	Revoked   bool // token was revoked
+	SignedOut bool // RP-initiated logout was redirected or queued in chain
+}
+
+// LogoutCallback defines signature for callback when Provider logs out user by sub and/or sid
+type LogoutCallback func(p *Provider, sub, sid string)
+
+// LogoutCallback sets a callback for back-channel logout from Provider
+// If session store is configured, matching sessions are deleted even without callback.
+func (g *Goic) LogoutCallback(cb LogoutCallback) *Goic {
+	g.logoutCb = cb
+	return g
+}
+
+// VerifyLogoutToken verifies logout_token of Provider as per OpenID back-channel logout (2.6)
+// It gives the verified claims which have sub and/or sid of user to log out.
+func (g *Goic) VerifyLogoutToken(p *Provider, raw string) (jwt.MapClaims, error) {
+	p, ok := g.provider(p.Name)
+	if !ok {
+		return nil, ErrProviderSupport
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, p.verifyKey,
+		jwt.WithIssuer(p.wk().Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	events, _ := claims["events"].(map[string]any)
+	if _, ok := events[backchannelEvent]; !ok {
+		return nil, ErrLogoutToken
+	}
+	if _, ok := claims["nonce"]; ok {
+		return nil, ErrLogoutToken
+	}
+	if claims["iat"] == nil {
+		return nil, ErrLogoutToken
+	}
+	if claimString(claims, "sub") == "" && claimString(claims, "sid") == "" {
+		return nil, ErrLogoutToken
+	}
+
+	jti := claimString(claims, "jti")
+	if jti == "" {
+		return nil, ErrLogoutToken
+	}
+
+	until := time.Now().Add(logoutJTITTL)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		until = exp.Time
+	}
+	if !g.rememberJTI(p.Name+" "+jti, until) {
+		return nil, ErrLogoutReplay
+	}
+	return claims, nil
+}
+
+// backchannelLogout handles the POSTed logout_token from Provider
+func (g *Goic) backchannelLogout(res http.ResponseWriter, req *http.Request, p *Provider) {
+	res.Header().Set("Cache-Control", "no-store")
+	if req.Method != http.MethodPost {
+		writeJSON(res, http.StatusMethodNotAllowed, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	claims, err := g.VerifyLogoutToken(p, req.PostFormValue("logout_token"))
+	if err != nil {
+		g.logger.InfoContext(req.Context(), "goic backchannel logout rejected", "provider", p.Name, "error", err)
+		g.auditLogout(req, p.Name, "", "", err)
+		writeJSON(res, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_request",
+			"error_description": "logout_token is invalid",
+		})
+		return
+	}
+
+	sub, sid := claimString(claims, "sub"), claimString(claims, "sid")
+	err = g.endSessions(p, sub, sid)
+	g.auditLogout(req, p.Name, sub, sid, err)
+	if err != nil {
+		g.logger.ErrorContext(req.Context(), "goic backchannel logout failed", "provider", p.Name, "error", err)
+		writeJSON(res, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_request",
+			"error_description": "logout failed",
+		})
+		return
+	}
+	if g.logoutCb != nil {
+		g.logoutCb(p, sub, sid)
+	}
+	res.WriteHeader(http.StatusOK)
+}
+
+// signedOut handles the redirect back from Provider after RP-initiated logout
+func (g *Goic) signedOut(res http.ResponseWriter, req *http.Request, p *Provider) {
+	state := req.URL.Query().Get("state")
+
+	g.sLock.Lock()
+	ls, ok := g.logouts[state]
+	delete(g.logouts, state)
+	g.sLock.Unlock()
+
+	if !ok || ls.provider != p.Name || time.Now().After(ls.expires) {
+		g.auditLogout(req, p.Name, "", "", ErrProviderState)
+		g.handleError(res, req, ErrProviderState, "signed out", p)
+		return
+	}
+
+	if s, err := g.Session(req); err == nil {
+		g.auditLogout(req, p.Name, s.Subject, s.SID, nil)
+	} else {
+		g.auditLogout(req, p.Name, "", "", nil)
+	}
+	g.ClearSession(res, req)
+	for len(ls.next) > 0 {
+		uri, err := g.signOutURL(ls.next[0], ls.redir, "", ls.next[1:], req)
+		if err == nil {
+			http.Redirect(res, req, uri, http.StatusFound)
+			return
+		}
+		ls.next = ls.next[1:]
+	}
+	http.Redirect(res, req, ls.redir, http.StatusFound)
+}
+
+// SignOutAll logs out from all the providers the current session signed into
+// It revokes the tokens where Provider CanRevoke, clears the local session,
+// and then chains the RP-initiated logout redirects where Provider CanSignOut,
+// finally landing at redir. The redir must be allowed same as for SignOut.
+func (g *Goic) SignOutAll(redir string, res http.ResponseWriter, req *http.Request) ([]LogoutResult, error) {
+	if redir != "" && !g.allowSignOut(redir) {
+		return nil, ErrSignOutRedir
+	}
+
+	s, err := g.Session(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []LogoutResult
+	var chain []*Token
+	for _, tok := range s.Tokens() {
+		r := LogoutResult{Provider: tok.Provider}
+		p := g.GetProvider(tok.Provider)
+		if p == nil {
+			r.Err = ErrProviderSupport
+			results = append(results, r)
+			continue
+		}
+		if p.CanRevoke() {
+			r.Err = g.RevokeTokens(tok)
+			r.Revoked = r.Err == nil
+		}
+		if p.CanSignOut() {
+			r.SignedOut = true
+			chain = append(chain, tok)
+		}
+		results = append(results, r)
+		g.audit(req, EventLogout, tok.Provider, tok, r.Err)
+	}
+
+	g.ClearSession(res, req)
+	if len(chain) == 0 {
+		http.Redirect(res, req, orDefault(redir, "/"), http.StatusFound)
+		return results, nil
+	}
+
+	uri, err := g.signOutURL(chain[0], redir, "", chain[1:], req)
+	if err != nil {
+		return results, err
+	}
+	http.Redirect(res, req, uri, http.StatusFound)
+	return results, nil
+}
+
+// frontchannelLogout handles the logout request from Provider loaded in iframe of user's browser
+func (g *Goic) frontchannelLogout(res http.ResponseWriter, req *http.Request, p *Provider) {
+	res.Header().Set("Cache-Control", "no-cache, no-store")
+	res.Header().Set("Pragma", "no-cache")
+
+	qry := req.URL.Query()
+	iss, sid := qry.Get("iss"), qry.Get("sid")
+	if iss != "" && iss != p.wk().Issuer {
+		http.Error(res, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Without iss and sid any third party page could log the user out, so ignore if session is required
+	if (p.FrontSession || p.wk().FrontSession) && (iss == "" || sid == "") {
+		g.auditLogout(req, p.Name, "", sid, ErrLogoutToken)
+		http.Error(res, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Without store, only the cookie can be cleared which browser sends in cross-site iframe only if SameSite=None
+	if o := g.session; o != nil && o.Store == nil && o.SameSite != http.SameSiteNoneMode {
+		g.logger.ErrorContext(req.Context(), "goic frontchannel logout needs session Store or SameSite=None cookie", "provider", p.Name)
+		g.auditLogout(req, p.Name, "", sid, ErrSessionNone)
+		http.Error(res, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		return
+	}
+
+	// Clear session of this browser, if it belongs to the logged out sid or to the Provider
+	if s, err := g.Session(req); err == nil && s.signedInto(p.Name, sid) {
+		g.ClearSession(res, req)
+	}
+	err := g.endSessions(p, "", sid)
+	g.auditLogout(req, p.Name, "", sid, err)
+	if err != nil {
+		g.logger.ErrorContext(req.Context(), "goic frontchannel logout failed", "provider", p.Name, "error", err)
+	}
+	if g.logoutCb != nil && sid != "" {
+		g.logoutCb(p, "", sid)
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = res.Write([]byte("<!DOCTYPE html><html><body>Logged out</body></html>"))
+}
+
+// endSessions deletes sessions from store by sub and/or sid, that were logged in with Provider
+func (g *Goic) endSessions(p *Provider, sub, sid string) error {
+	if (sub == "" && sid == "") || g.session == nil || g.session.Store == nil {
+		return nil
+	}
+
+	// Lookup by sub if given, the sid is then matched on each session
+	store := g.session.Store
+	lookup, key := store.BySID, sid
+	if sub != "" {
+		lookup, key = store.BySubject, sub
+	}
+
+	ids, err := lookup(key)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		s, err := store.Get(id)
+		if err != nil || !s.signedInto(p.Name, sid) {
+			continue
+		}
+		if err := store.Delete(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rememberLogout remembers the state of RP-initiated logout for logoutTTL, forgetting expired ones
+func (g *Goic) rememberLogout(state string, ls logoutState) {
+	now := time.Now()
+	ls.expires = now.Add(logoutTTL)
+
+	g.sLock.Lock()
+	defer g.sLock.Unlock()
+
+	for k, v := range g.logouts {
+		if now.After(v.expires) {
+			delete(g.logouts, k)
+		}
+	}
+	g.logouts[state] = ls
+}
+
+// rememberJTI remembers jti until given time, false if it is already remembered
+func (g *Goic) rememberJTI(jti string, until time.Time) bool {
+	now := time.Now()
+
+	g.sLock.Lock()
+	defer g.sLock.Unlock()
+
+	for k, v := range g.logoutJTIs {
+		if now.After(v) {
+			delete(g.logoutJTIs, k)
+		}
+	}
+	if _, ok := g.logoutJTIs[jti]; ok {
+		return false
+	}
+
+	g.logoutJTIs[jti] = until
+	return true
+}
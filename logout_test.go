@@ -0,0 +1,134 @@
+package goic
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// logoutClaims gives valid logout_token claims with given jti
+func logoutClaims(jti string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    testIssuer,
+		"aud":    "client",
+		"iat":    time.Now().Unix(),
+		"jti":    jti,
+		"sub":    "user",
+		"sid":    "sid1",
+		"events": map[string]any{backchannelEvent: map[string]any{}},
+	}
+}
+
+func TestVerifyLogoutToken(t *testing.T) {
+	g := New("/auth", false)
+	p := testProvider(g, "idp", nil)
+
+	tests := []struct {
+		name   string
+		modify func(c jwt.MapClaims)
+		err    error // nil for valid, ErrLogoutToken or any jwt error otherwise
+	}{
+		{name: "valid", modify: func(c jwt.MapClaims) {}},
+		{name: "sid only", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "no events", modify: func(c jwt.MapClaims) { delete(c, "events") }, err: ErrLogoutToken},
+		{name: "other event", modify: func(c jwt.MapClaims) { c["events"] = map[string]any{"x": map[string]any{}} }, err: ErrLogoutToken},
+		{name: "nonce", modify: func(c jwt.MapClaims) { c["nonce"] = "n" }, err: ErrLogoutToken},
+		{name: "no iat", modify: func(c jwt.MapClaims) { delete(c, "iat") }, err: ErrLogoutToken},
+		{name: "no jti", modify: func(c jwt.MapClaims) { delete(c, "jti") }, err: ErrLogoutToken},
+		{name: "no sub and sid", modify: func(c jwt.MapClaims) { delete(c, "sub"); delete(c, "sid") }, err: ErrLogoutToken},
+		{name: "wrong iss", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }, err: jwt.ErrTokenInvalidIssuer},
+		{name: "wrong aud", modify: func(c jwt.MapClaims) { c["aud"] = "other" }, err: jwt.ErrTokenInvalidAudience},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, err: jwt.ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := logoutClaims("jti-" + tt.name)
+			tt.modify(claims)
+
+			_, err := g.VerifyLogoutToken(p, signToken(t, claims))
+			if tt.err == nil && err != nil {
+				t.Fatalf("expected valid, got %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyLogoutTokenReplay(t *testing.T) {
+	g := New("/auth", false)
+	p := testProvider(g, "idp", nil)
+	raw := signToken(t, logoutClaims("once"))
+
+	if _, err := g.VerifyLogoutToken(p, raw); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := g.VerifyLogoutToken(p, raw); err != ErrLogoutReplay {
+		t.Fatalf("expected ErrLogoutReplay on second use, got %v", err)
+	}
+}
+
+func TestVerifyLogoutTokenSignature(t *testing.T) {
+	g := New("/auth", false)
+	p := testProvider(g, "idp", nil)
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, logoutClaims("hmac"))
+	raw, _ := tok.SignedString([]byte("not the client secret"))
+	if _, err := g.VerifyLogoutToken(p, raw); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+}
+
+func TestFrontchannelLogout(t *testing.T) {
+	g := New("/auth", false).WithSession(&SessionOptions{Keys: [][]byte{testKey1}})
+	testProvider(g, "idp", nil)
+	testProvider(g, "other", nil)
+
+	rec := httptest.NewRecorder()
+	g.MiddlewareHandler(nil).ServeHTTP(rec, httptest.NewRequest("GET", "/auth/idp/frontchannel-logout", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 for cookie session that is not SameSite=None, got %d", rec.Code)
+	}
+
+	g.session.SameSite = http.SameSiteNoneMode
+	linked := &Token{Provider: "idp", IDToken: signToken(t, jwt.MapClaims{"sid": "sid1"})}
+	req := saveSession(t, g, &Session{Token: &Token{Provider: "other"}, Linked: []*Token{linked}})
+
+	rec = httptest.NewRecorder()
+	req.URL.Path, req.URL.RawQuery = "/auth/idp/frontchannel-logout", "sid=sid1"
+	g.MiddlewareHandler(nil).ServeHTTP(rec, req)
+	if c := rec.Result().Cookies(); rec.Code != http.StatusOK || len(c) == 0 || c[0].MaxAge >= 0 {
+		t.Errorf("expected session with linked sid to be cleared, got %d %v", rec.Code, c)
+	}
+}
+
+func TestFrontchannelLogoutSessionRequired(t *testing.T) {
+	g := New("/auth", false).WithSession(&SessionOptions{Keys: [][]byte{testKey1}, SameSite: http.SameSiteNoneMode})
+	testProvider(g, "idp", &WellKnown{FrontSession: true})
+	tok := &Token{Provider: "idp", IDToken: signToken(t, jwt.MapClaims{"sid": "sid1"})}
+
+	for _, query := range []string{"", "sid=sid1", "iss=" + testIssuer} {
+		req := saveSession(t, g, &Session{Token: tok, SID: "sid1"})
+		req.URL.Path, req.URL.RawQuery = "/auth/idp/frontchannel-logout", query
+
+		rec := httptest.NewRecorder()
+		g.MiddlewareHandler(nil).ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest || len(rec.Result().Cookies()) != 0 {
+			t.Errorf("%q: expected request without iss and sid to be ignored, got %d", query, rec.Code)
+		}
+	}
+
+	req := saveSession(t, g, &Session{Token: tok, SID: "sid1"})
+	req.URL.Path, req.URL.RawQuery = "/auth/idp/frontchannel-logout", "iss="+testIssuer+"&sid=sid1"
+	rec := httptest.NewRecorder()
+	g.MiddlewareHandler(nil).ServeHTTP(rec, req)
+	if c := rec.Result().Cookies(); rec.Code != http.StatusOK || len(c) == 0 || c[0].MaxAge >= 0 {
+		t.Errorf("expected session of sid to be cleared, got %d %v", rec.Code, c)
+	}
+}
@@ -0,0 +1,140 @@
+package goic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// loopbackHTML is the page shown in browser at the end of loopback flow
+var loopbackHTML = `<!DOCTYPE html><html><head><meta charset="utf-8"><title>%s</title></head>` +
+	`<body style="font-family:sans-serif;text-align:center;margin-top:4em"><h3>%s</h3><p>%s</p></body></html>`
+
+// loopbackResult is the outcome of loopback callback
+type loopbackResult struct {
+	tok *Token
+	err error
+}
+
+// LoopbackAuth runs the authorization code flow with PKCE for native and CLI apps (RFC8252)
+// It listens on 127.0.0.1 with ephemeral port for the redirect, opens the auth URL with
+// given open func (OpenBrowser if nil, or prints it if opening fails), then waits for the
+// callback, verifies the token and shuts down. The Provider must allow loopback redirect URI.
+// Public clients without secret (see WithClientID) authenticate with PKCE alone.
+func (g *Goic) LoopbackAuth(ctx context.Context, p *Provider, open func(uri string) error) (*Token, *User, error) {
+	p, ok := g.provider(p.Name)
+	if !ok {
+		return nil, nil, ErrProviderSupport
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	redir := fmt.Sprintf("http://127.0.0.1:%d/callback", ln.Addr().(*net.TCPAddr).Port)
+	state, nonce, verifier := RandomString(stateLength), RandomString(nonceLength), randomID()
+	sum := sha256.Sum256([]byte(verifier))
+
+	uri := AuthRedirectURL(p, state, nonce, redir)
+	if uri == "" {
+		ln.Close()
+		return nil, nil, ErrProviderSupport
+	}
+	uri += "&code_challenge=" + base64.RawURLEncoding.EncodeToString(sum[:]) + "&code_challenge_method=S256"
+
+	done := make(chan loopbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(res http.ResponseWriter, req *http.Request) {
+		// Ignore stray requests like prefetch or port scan, and keep waiting for the real one
+		if req.URL.Query().Get("state") != state {
+			http.NotFound(res, req)
+			return
+		}
+
+		tok, err := g.loopbackCallback(req.Context(), p, req.URL.Query(), state, nonce, verifier, redir)
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(res, loopbackHTML, "Login failed", "Login failed", html.EscapeString(err.Error()))
+		} else {
+			_, _ = fmt.Fprintf(res, loopbackHTML, "Login complete", "Login complete", "You can close this window now.")
+		}
+
+		select {
+		case done <- loopbackResult{tok, err}:
+		default:
+		}
+	})
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+
+	if open == nil {
+		open = OpenBrowser
+	}
+	if err := open(uri); err != nil {
+		fmt.Fprintf(os.Stderr, "Open this URL in browser to log in:\n%s\n", uri)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			return r.tok, nil, r.err
+		}
+		return r.tok, g.UserInfo(r.tok), nil
+	}
+}
+
+// loopbackCallback checks the callback query and exchanges code for verified Token
+func (g *Goic) loopbackCallback(ctx context.Context, p *Provider, qry url.Values, state, nonce, verifier, redir string) (*Token, error) {
+	if err := queryError(qry, p); err != nil {
+		return nil, err
+	}
+	if qry.Get("state") != state {
+		return nil, ErrProviderState
+	}
+
+	form := url.Values{}
+	form.Add("grant_type", "authorization_code")
+	form.Add("code", qry.Get("code"))
+	form.Add("redirect_uri", redir)
+	form.Add("code_verifier", verifier)
+
+	tok, err := g.tokenRequest(ctx, p, form)
+	if err != nil {
+		return tok, fmt.Errorf("get token: %w", err)
+	}
+	if err := g.verifyToken(p, tok, nonce); err != nil {
+		return tok, fmt.Errorf("verify token: %w", err)
+	}
+	return tok, nil
+}
+
+// OpenBrowser opens the uri in default browser of the OS
+func OpenBrowser(uri string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", uri).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", uri).Start()
+	default:
+		return exec.Command("xdg-open", uri).Start()
+	}
+}
@@ -0,0 +1,75 @@
+package goic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLoopbackAuth(t *testing.T) {
+	var nonce string
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_ = req.ParseForm()
+		form = req.PostForm
+		idt := signToken(t, jwt.MapClaims{
+			"iss": testIssuer, "aud": "native", "sub": "user", "nonce": nonce, "exp": time.Now().Add(time.Minute).Unix(),
+			"name": "U", "given_name": "U", "family_name": "V", "email": "u@v.w", "picture": "",
+		})
+		_, _ = res.Write([]byte(`{"access_token":"at","token_type":"Bearer","id_token":"` + idt + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	g := New("/auth", false)
+	p := g.AddProvider(stubProvider("idp", &WellKnown{AuthURI: "https://idp.test/auth", TokenURI: srv.URL}).WithClientID("native"))
+
+	var strays []int
+	open := func(uri string) error {
+		u, _ := url.Parse(uri)
+		qry := u.Query()
+		nonce = qry.Get("nonce")
+		cb, _ := url.Parse(qry.Get("redirect_uri"))
+
+		// stray requests must not end the flow
+		for _, path := range []string{"/favicon.ico", "/callback", "/callback?state=wrong&code=x"} {
+			res, err := http.Get(cb.Scheme + "://" + cb.Host + path)
+			if err != nil {
+				return err
+			}
+			res.Body.Close()
+			strays = append(strays, res.StatusCode)
+		}
+
+		go func() {
+			res, err := http.Get(cb.String() + "?code=c&state=" + url.QueryEscape(qry.Get("state")))
+			if err == nil {
+				res.Body.Close()
+			}
+		}()
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tok, user, err := g.LoopbackAuth(ctx, p, open)
+	if err != nil {
+		t.Fatalf("loopback auth: %v", err)
+	}
+	if tok.AccessToken != "at" || user.Subject != "user" {
+		t.Errorf("expected verified token and user, got %+v %+v", tok, user)
+	}
+	for _, code := range strays {
+		if code != http.StatusNotFound {
+			t.Errorf("expected stray request to be ignored with 404, got %d", code)
+		}
+	}
+	if _, ok := form["client_secret"]; ok || form.Get("client_id") != "native" || form.Get("code_verifier") == "" {
+		t.Errorf("expected public client with PKCE only, got form %v", form)
+	}
+}
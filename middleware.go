@@ -0,0 +1,107 @@
+package goic
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ctxKey is the type for request context keys of goic
+type ctxKey int
+
+const (
+	userKey ctxKey = iota
+	tokenKey
+	returnKey
+	claimsKey
+)
+
+// returnTTL is how long the URL to return to is kept for the login to complete
+var returnTTL = 15 * time.Minute
+
+// returnTo is where to return to after login
+type returnTo struct {
+	uri     string
+	link    string // key of the session that asked to link the login
+	expires time.Time
+}
+
+// RequireAuth gives middleware that allows only the requests with valid session
+// Unauthenticated browser requests are redirected to login with given Provider,
+// and are brought back to original URL after login. API or XHR requests get 401.
+// The User and Token are available in request context of the next handler.
+func (g *Goic) RequireAuth(p *Provider) func(http.Handler) http.Handler {
+	if g.session == nil {
+		log.Fatalf("goic require auth: session is not enabled, use WithSession()")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			s, err := g.TouchSession(res, req)
+			if err == nil {
+				next.ServeHTTP(res, req.WithContext(withAuth(req.Context(), s.User, s.Token)))
+				return
+			}
+
+			if wantsJSON(req) {
+				res.Header().Set("WWW-Authenticate", `Bearer realm="goic"`)
+				writeJSON(res, http.StatusUnauthorized, map[string]string{
+					"error":             "unauthorized",
+					"error_description": "authentication required",
+				})
+				return
+			}
+
+			uri := g.URIPrefix + "/" + p.Name + "?return_to=" + url.QueryEscape(req.URL.RequestURI())
+			http.Redirect(res, req, uri, http.StatusFound)
+		})
+	}
+}
+
+// UserFromContext gives the User put in context by RequireAuth, nil if absent
+func UserFromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(userKey).(*User)
+	return u
+}
+
+// TokenFromContext gives the Token put in context by RequireAuth, nil if absent
+func TokenFromContext(ctx context.Context) *Token {
+	t, _ := ctx.Value(tokenKey).(*Token)
+	return t
+}
+
+// ReturnTo gives the URL to go after login, it can be used in UserCallback
+// It is the URL originally requested before RequireAuth redirected to login, or "/".
+func ReturnTo(req *http.Request) string {
+	if uri, ok := req.Context().Value(returnKey).(string); ok && uri != "" {
+		return uri
+	}
+	return "/"
+}
+
+// withAuth gives context with User and Token
+func withAuth(ctx context.Context, u *User, t *Token) context.Context {
+	return context.WithValue(context.WithValue(ctx, userKey, u), tokenKey, t)
+}
+
+// wantsJSON checks if the request is from API or XHR client rather than browser
+func wantsJSON(req *http.Request) bool {
+	if req.Header.Get("X-Requested-With") == "XMLHttpRequest" || req.Header.Get("Authorization") != "" {
+		return true
+	}
+
+	accept := req.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// safeReturn checks if uri is local path that is safe to redirect to
+func safeReturn(uri string) bool {
+	if !strings.HasPrefix(uri, "/") || strings.HasPrefix(uri, "//") || strings.HasPrefix(uri, "/\\") {
+		return false
+	}
+	u, err := url.Parse(uri)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
@@ -0,0 +1,100 @@
+package goic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireAuth(t *testing.T) {
+	g := sessionGoic(&SessionOptions{Keys: [][]byte{testKey1}})
+	p := testProvider(g, "idp", nil)
+	handler := g.RequireAuth(p)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte(UserFromContext(req.Context()).Email))
+	}))
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		header string
+		want   string
+	}{
+		{name: "browser", status: http.StatusFound, header: "Location", want: "/auth/idp?return_to=%2Fapp%3Fx%3D1"},
+		{name: "xhr", status: http.StatusUnauthorized, header: "WWW-Authenticate", want: `Bearer realm="goic"`},
+		{name: "json", status: http.StatusUnauthorized, header: "WWW-Authenticate", want: `Bearer realm="goic"`},
+		{name: "session", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/app?x=1", nil)
+			switch tt.name {
+			case "xhr":
+				req.Header.Set("X-Requested-With", "XMLHttpRequest")
+			case "json":
+				req.Header.Set("Accept", "application/json")
+			case "session":
+				req = saveSession(t, g, &Session{Token: &Token{Provider: "idp", AccessToken: "a"}, User: &User{Email: "a@b.c"}})
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.header != "" && rec.Header().Get(tt.header) != tt.want {
+				t.Errorf("expected %s %q, got %q", tt.header, tt.want, rec.Header().Get(tt.header))
+			}
+			if tt.name == "session" && rec.Body.String() != "a@b.c" {
+				t.Errorf("expected user in context, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSafeReturn(t *testing.T) {
+	tests := map[string]bool{
+		"/":                    true,
+		"/app?x=1#y":           true,
+		"":                     false,
+		"//evil.com":           false,
+		"/\\evil.com":          false,
+		"https://evil.com":     false,
+		"javascript:alert(1)":  false,
+		"evil.com/path":        false,
+		"///evil.com":          false,
+		"http:/evil.com":       false,
+		"/%2F%2Fevil.com/path": true, // stays local, the path is not decoded to host
+	}
+
+	for uri, want := range tests {
+		if got := safeReturn(uri); got != want {
+			t.Errorf("safeReturn(%q): expected %v, got %v", uri, want, got)
+		}
+	}
+}
+
+func TestReturnToExpiry(t *testing.T) {
+	g := New("/auth", false)
+	g.rememberReturn("s1", returnTo{uri: "/one"})
+	if rt := g.popReturn("s1"); rt.uri != "/one" {
+		t.Errorf("expected remembered return URL, got %q", rt.uri)
+	}
+	if uri := g.popReturn("s1").uri; uri != "" {
+		t.Errorf("expected return URL to be forgotten after use, got %q", uri)
+	}
+
+	defer func(ttl time.Duration) { returnTTL = ttl }(returnTTL)
+	returnTTL = -time.Second
+	g.rememberReturn("s2", returnTo{uri: "/two"})
+	g.rememberReturn("s3", returnTo{uri: "/three"})
+
+	if n := len(g.returns); n != 1 {
+		t.Errorf("expected expired return URLs to be swept, got %d", n)
+	}
+	if uri := g.popReturn("s3").uri; uri != "" {
+		t.Errorf("expected expired return URL to be ignored, got %q", uri)
+	}
+}
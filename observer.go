@@ -0,0 +1,81 @@
+package goic
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Stage is a stage of OpenID flow that is observed
+type Stage string
+
+// The observed stages of OpenID flow
+const (
+	StageAuthRedirect Stage = "auth_redirect"
+	StageCallback     Stage = "callback"
+	StageToken        Stage = "token"
+	StageVerify       Stage = "verify"
+	StageUserInfo     Stage = "userinfo"
+	StageRefresh      Stage = "refresh"
+	StageRevoke       Stage = "revoke"
+	StageDiscovery    Stage = "discovery"
+)
+
+// Observation is the outcome of a Stage of OpenID flow
+type Observation struct {
+	Stage    Stage
+	Provider string
+	Start    time.Time
+	Duration time.Duration
+	Err      error // nil on success
+}
+
+// Observer observes the stages of OpenID flow, eg: for metrics and tracing
+// It is invoked synchronously so it must be fast and safe for concurrent use.
+type Observer interface {
+	Observe(ctx context.Context, o Observation)
+}
+
+// ObserverFunc is a func that implements Observer
+type ObserverFunc func(ctx context.Context, o Observation)
+
+// Observe implements Observer
+func (fn ObserverFunc) Observe(ctx context.Context, o Observation) { fn(ctx, o) }
+
+// WithObserver adds Observers that are invoked at each stage of OpenID flow
+func (g *Goic) WithObserver(obs ...Observer) *Goic {
+	g.observers = append(g.observers, obs...)
+	return g
+}
+
+// Outcome gives success or failure of the Observation
+func (o Observation) Outcome() string {
+	if o.Err == nil {
+		return "success"
+	}
+	return "failure"
+}
+
+// ErrorCode gives OAuth error code if the Observation failed due to OAuthError, or error otherwise
+func (o Observation) ErrorCode() string {
+	var oe *OAuthError
+	if o.Err == nil {
+		return ""
+	}
+	if errors.As(o.Err, &oe) && oe.Code != "" {
+		return oe.Code
+	}
+	return "error"
+}
+
+// observe notifies the Observers about the Stage that started at start
+func (g *Goic) observe(ctx context.Context, stage Stage, provider string, start time.Time, err error) {
+	if len(g.observers) == 0 {
+		return
+	}
+
+	o := Observation{Stage: stage, Provider: provider, Start: start, Duration: time.Since(start), Err: err}
+	for _, ob := range g.observers {
+		ob.Observe(ctx, o)
+	}
+}
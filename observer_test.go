@@ -0,0 +1,63 @@
+package goic
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestObserverAdapters(t *testing.T) {
+	srv := tokenServer(t, http.StatusOK, `{"access_token":"at","token_type":"Bearer","expires_in":60}`)
+	metrics, spans := NewPromObserver(), &InMemoryExporter{}
+	g := New("/auth", false).WithObserver(metrics, NewTraceObserver(spans))
+	testProvider(g, "idp", &WellKnown{TokenURI: srv.URL})
+
+	if _, err := g.ClientCredentials(context.Background(), g.GetProvider("idp"), nil, ""); err != nil {
+		t.Fatalf("client credentials: %v", err)
+	}
+	if _, err := g.RefreshToken(&Token{Provider: "idp"}); err == nil {
+		t.Fatal("expected refresh without refresh token to fail")
+	}
+
+	var names []string
+	for _, s := range spans.Spans() {
+		names = append(names, s.Name+":"+s.Attributes["goic.outcome"])
+	}
+	want := "goic.discovery:success goic.token:success goic.refresh:failure"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("expected spans %q, got %q", want, got)
+	}
+
+	var out strings.Builder
+	if _, err := metrics.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`goic_stage_total{stage="token",provider="idp",outcome="success"} 1`,
+		`goic_stage_total{stage="refresh",provider="idp",outcome="failure"} 1`,
+		`goic_stage_duration_seconds_count{stage="token",provider="idp"} 1`,
+		`goic_stage_duration_seconds_bucket{stage="token",provider="idp",le="+Inf"} 1`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected metric line %q in:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestObserverVerify(t *testing.T) {
+	spans := &InMemoryExporter{}
+	g := New("/auth", false).WithObserver(NewTraceObserver(spans))
+	p := testProvider(g, "idp", nil)
+	spans.Reset()
+
+	tok := &Token{Provider: "idp", IDToken: signToken(t, map[string]any{"iss": testIssuer, "exp": 1})}
+	if err := g.verifyToken(p, tok, ""); err == nil {
+		t.Fatal("expected verification to fail for expired token")
+	}
+
+	got := spans.Spans()
+	if len(got) != 1 || got[0].Name != "goic.verify" || got[0].Err == nil || got[0].Attributes["error.type"] == "" {
+		t.Errorf("expected failed verify span, got %+v", got)
+	}
+}
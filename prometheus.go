@@ -0,0 +1,134 @@
+package goic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// promBuckets are the default histogram buckets in seconds
+var promBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// promEscaper escapes Prometheus label values
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PromObserver is Observer that collects metrics in Prometheus text format
+// It counts the stages by outcome and records their durations as histogram.
+// Serve it as http.Handler at your metrics endpoint, eg: /metrics
+type PromObserver struct {
+	buckets []float64
+	counts  map[promKey]uint64
+	hists   map[promKey]*promHist
+	mu      sync.Mutex
+}
+
+// promKey is the label set of metric
+type promKey struct {
+	stage, provider, outcome string
+}
+
+// promHist is histogram of durations
+type promHist struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewPromObserver gives new PromObserver with given histogram buckets in seconds, or default ones
+func NewPromObserver(buckets ...float64) *PromObserver {
+	if len(buckets) == 0 {
+		buckets = promBuckets
+	}
+	return &PromObserver{
+		buckets: buckets,
+		counts:  make(map[promKey]uint64),
+		hists:   make(map[promKey]*promHist),
+	}
+}
+
+// Observe implements Observer
+func (m *PromObserver) Observe(_ context.Context, o Observation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counts[promKey{string(o.Stage), o.Provider, o.Outcome()}]++
+
+	key := promKey{stage: string(o.Stage), provider: o.Provider}
+	h, ok := m.hists[key]
+	if !ok {
+		h = &promHist{buckets: make([]uint64, len(m.buckets))}
+		m.hists[key] = h
+	}
+
+	sec := o.Duration.Seconds()
+	for i, le := range m.buckets {
+		if sec <= le {
+			h.buckets[i]++
+		}
+	}
+	h.sum += sec
+	h.count++
+}
+
+// ServeHTTP implements http.Handler
+func (m *PromObserver) ServeHTTP(res http.ResponseWriter, _ *http.Request) {
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(res)
+}
+
+// WriteTo writes the metrics in Prometheus text exposition format
+func (m *PromObserver) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP goic_stage_total Count of OpenID flow stages by outcome.\n")
+	b.WriteString("# TYPE goic_stage_total counter\n")
+	for _, k := range sortedKeys(m.counts) {
+		fmt.Fprintf(&b, "goic_stage_total{%s,outcome=\"%s\"} %d\n", k.labels(), promEscaper.Replace(k.outcome), m.counts[k])
+	}
+
+	b.WriteString("# HELP goic_stage_duration_seconds Duration of OpenID flow stages.\n")
+	b.WriteString("# TYPE goic_stage_duration_seconds histogram\n")
+	for _, k := range sortedKeys(m.hists) {
+		h := m.hists[k]
+		for i, le := range m.buckets {
+			fmt.Fprintf(&b, "goic_stage_duration_seconds_bucket{%s,le=\"%s\"} %d\n", k.labels(), strconv.FormatFloat(le, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(&b, "goic_stage_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k.labels(), h.count)
+		fmt.Fprintf(&b, "goic_stage_duration_seconds_sum{%s} %s\n", k.labels(), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "goic_stage_duration_seconds_count{%s} %d\n", k.labels(), h.count)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// labels gives the stage and provider labels of promKey
+func (k promKey) labels() string {
+	return `stage="` + promEscaper.Replace(k.stage) + `",provider="` + promEscaper.Replace(k.provider) + `"`
+}
+
+// sortedKeys gives the keys of metric map in stable order
+func sortedKeys[V any](m map[promKey]V) []promKey {
+	keys := make([]promKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.stage != b.stage {
+			return a.stage < b.stage
+		}
+		if a.provider != b.provider {
+			return a.provider < b.provider
+		}
+		return a.outcome < b.outcome
+	})
+	return keys
+}
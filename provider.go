@@ -1,12 +1,17 @@
 package goic
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // Provider represents OpenID Connect provider
@@ -14,7 +19,9 @@ type Provider struct {
 	wellKnown    *WellKnown
 	WellKnowner  func() (*WellKnown, error) // allows user to set own loader
 	QueryFn      func() string
+	ClientAuth   ClientAuthFunc // how client authenticates to provider endpoints
 	err          error
+	RoleClaims   []string
 	Name         string
 	URL          string
 	Scope        string
@@ -23,21 +30,27 @@ type Provider struct {
 	clientSecret string
 	ResType      string
 	Sandbox      bool
+	FrontSession bool // frontchannel_logout_session_required, front-channel logout needs iss and sid
 	discovered   bool
+	mu           sync.RWMutex // guards wellKnown, err and discovered
 }
 
 // WellKnown represents OpenID Connect well-known config
 type WellKnown struct {
-	Issuer      string   `json:"issuer"`
-	KeysURI     string   `json:"jwks_uri"`
-	AuthURI     string   `json:"authorization_endpoint"`
-	TokenURI    string   `json:"token_endpoint"`
-	UserInfoURI string   `json:"userinfo_endpoint"`
-	SignOutURI  string   `json:"end_session_endpoint,omitempty"`
-	RevokeURI   string   `json:"revocation_endpoint,omitempty"`
-	XRevokeURI  string   `json:"token_revocation_endpoint,omitempty"`
-	AlgoSupport []string `json:"id_token_signing_alg_values_supported"`
-	jwks        struct {
+	Issuer        string   `json:"issuer"`
+	KeysURI       string   `json:"jwks_uri"`
+	AuthURI       string   `json:"authorization_endpoint"`
+	TokenURI      string   `json:"token_endpoint"`
+	UserInfoURI   string   `json:"userinfo_endpoint"`
+	SignOutURI    string   `json:"end_session_endpoint,omitempty"`
+	RevokeURI     string   `json:"revocation_endpoint,omitempty"`
+	XRevokeURI    string   `json:"token_revocation_endpoint,omitempty"`
+	IntrospectURI string   `json:"introspection_endpoint,omitempty"`
+	DeviceAuthURI string   `json:"device_authorization_endpoint,omitempty"`
+	CIBAuthURI    string   `json:"backchannel_authentication_endpoint,omitempty"`
+	FrontSession  bool     `json:"frontchannel_logout_session_supported,omitempty"` // sends iss and sid in front-channel logout
+	AlgoSupport   []string `json:"id_token_signing_alg_values_supported"`
+	jwks          struct {
 		Keys []struct {
 			Alg string `json:"alg"`
 			Use string `json:"use,omitempty"`
@@ -52,6 +65,24 @@ type WellKnown struct {
 	}
 }
 
+// ClientAuthFunc authenticates the client in a request to Provider endpoint
+// It may add credentials to either the form or the header.
+type ClientAuthFunc func(p *Provider, form url.Values, h http.Header)
+
+// ClientSecretBasic authenticates client with id and secret in Authorization header
+func ClientSecretBasic(p *Provider, _ url.Values, h http.Header) {
+	h.Set("Authorization", p.AuthBasicHeader())
+}
+
+// ClientSecretPost authenticates client with id and secret in the form body
+// The secret is omitted for public clients that have none.
+func ClientSecretPost(p *Provider, form url.Values, _ http.Header) {
+	form.Set("client_id", p.clientID)
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+}
+
 // Microsoft is ready to use Provider instance
 var Microsoft = &Provider{
 	Name:  "microsoft",
@@ -108,6 +139,17 @@ func (p *Provider) WithCredential(id, secret string) *Provider {
 	return p
 }
 
+// WithClientID sets client id for a public Provider client that has no secret
+// It is meant for native and CLI apps using LoopbackAuth, which is protected by PKCE.
+func (p *Provider) WithClientID(id string) *Provider {
+	if id == "" {
+		log.Fatalf("goic (%s): client ID may not be empty", p.Name)
+	}
+
+	p.clientID = id
+	return p
+}
+
 // WithScope sets scope for a Provider
 func (p *Provider) WithScope(s string) *Provider {
 	if s == "" || !strings.Contains(s, "openid") {
@@ -118,6 +160,20 @@ func (p *Provider) WithScope(s string) *Provider {
 	return p
 }
 
+// WithRoleClaims sets claim paths where roles and groups are found for a Provider
+// The paths can be nested with dots, eg: realm_access.roles for Keycloak.
+func (p *Provider) WithRoleClaims(paths ...string) *Provider {
+	p.RoleClaims = paths
+	return p
+}
+
+// WithClientAuth sets how client authenticates to Provider endpoints
+// Use ClientSecretBasic, ClientSecretPost or your own ClientAuthFunc.
+func (p *Provider) WithClientAuth(fn ClientAuthFunc) *Provider {
+	p.ClientAuth = fn
+	return p
+}
+
 // SetQuery sets query func for inital auth request
 func (p *Provider) SetQuery(fn func() string) *Provider {
 	p.QueryFn = fn
@@ -125,7 +181,11 @@ func (p *Provider) SetQuery(fn func() string) *Provider {
 }
 
 // SetErr sets last encountered error
-func (p *Provider) SetErr(err error) { p.err = err }
+func (p *Provider) SetErr(err error) {
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+}
 
 // Is checks if provider is given type
 func (p *Provider) Is(name string) bool {
@@ -134,10 +194,6 @@ func (p *Provider) Is(name string) bool {
 
 // getWellKnown gets the well known config from Provider remote
 func (p *Provider) getWellKnown() (*WellKnown, error) {
-	if nil != p.wellKnown && p.discovered {
-		return p.wellKnown, nil
-	}
-
 	// Fetch well-known config
 	res, err := http.Get(strings.TrimSuffix(p.URL, "/") + "/.well-known/openid-configuration")
 	if err != nil {
@@ -145,7 +201,6 @@ func (p *Provider) getWellKnown() (*WellKnown, error) {
 	}
 
 	defer res.Body.Close()
-	p.discovered = true
 
 	var wk = &WellKnown{}
 	if err := json.NewDecoder(res.Body).Decode(wk); err != nil {
@@ -170,23 +225,40 @@ func (p *Provider) getWellKnown() (*WellKnown, error) {
 	if err := json.NewDecoder(res.Body).Decode(&wk.jwks); err != nil {
 		return wk, err
 	}
-	log.Println(p.Name+":", "loaded .well-known openid config")
 	return wk, nil
 }
 
+// wk gives the current well-known config, it is never nil
+func (p *Provider) wk() *WellKnown {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.wellKnown == nil {
+		return &WellKnown{}
+	}
+	return p.wellKnown
+}
+
 // GetURI gets an endpoint for given action
 func (p *Provider) GetURI(action string) (uri string) {
+	wk := p.wk()
 	switch action {
 	case "auth":
-		uri = p.wellKnown.AuthURI
+		uri = wk.AuthURI
 	case "token":
-		uri = p.wellKnown.TokenURI
+		uri = wk.TokenURI
 	case "userinfo":
-		uri = p.wellKnown.UserInfoURI
+		uri = wk.UserInfoURI
 	case "revoke":
-		uri = p.wellKnown.RevokeURI
+		uri = wk.RevokeURI
 	case "signout":
-		uri = p.wellKnown.SignOutURI
+		uri = wk.SignOutURI
+	case "introspect":
+		uri = wk.IntrospectURI
+	case "device":
+		uri = wk.DeviceAuthURI
+	case "ciba":
+		uri = wk.CIBAuthURI
 	}
 
 	// if p.Sandbox && p.Is("paypal") {
@@ -197,12 +269,35 @@ func (p *Provider) GetURI(action string) (uri string) {
 
 // CanRevoke checks if token can be revoked for this Provider
 func (p *Provider) CanRevoke() bool {
-	return p.wellKnown.RevokeURI != ""
+	return p.wk().RevokeURI != ""
+}
+
+// CanIntrospect checks if token can be introspected for this Provider
+func (p *Provider) CanIntrospect() bool {
+	return p.wk().IntrospectURI != ""
+}
+
+// CanDeviceAuth checks if device authorization grant is supported by this Provider
+func (p *Provider) CanDeviceAuth() bool {
+	return p.wk().DeviceAuthURI != ""
+}
+
+// CanCIBA checks if client initiated backchannel authentication is supported by this Provider
+func (p *Provider) CanCIBA() bool {
+	return p.wk().CIBAuthURI != ""
+}
+
+// authClient authenticates client in the request, using def if ClientAuth is not set
+func (p *Provider) authClient(form url.Values, h http.Header, def ClientAuthFunc) {
+	if p.ClientAuth != nil {
+		def = p.ClientAuth
+	}
+	def(p, form, h)
 }
 
 // CanSignOut checks if token can be signed out for this Provider
 func (p *Provider) CanSignOut() bool {
-	return p.wellKnown.SignOutURI != ""
+	return p.wk().SignOutURI != ""
 }
 
 // AuthBasicHeader gives a string ready to use as Authorization header
@@ -213,3 +308,38 @@ func (p *Provider) AuthBasicHeader() string {
 
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(id+":"+pass))
 }
+
+// verifyKey gives the key to verify signature of id_token like JWT t
+// HMAC signed token is verified with client secret, others with jwks public key.
+func (p *Provider) verifyKey(t *jwt.Token) (any, error) {
+	alg, _ := t.Header["alg"].(string)
+	if len(alg) < 2 {
+		return nil, ErrTokenAlgo
+	}
+
+	al2 := alg[0:2]
+	if al2 == "HS" {
+		return []byte(p.clientSecret), nil
+	}
+	if al2 != "RS" && al2 != "ES" {
+		return nil, ErrTokenAlgo
+	}
+
+	return p.publicKey(t)
+}
+
+// publicKey gives the jwks public key to verify signature of JWT t
+func (p *Provider) publicKey(t *jwt.Token) (any, error) {
+	alg, _ := t.Header["alg"].(string)
+	for _, key := range p.wk().jwks.Keys {
+		kid := key.Kid == t.Header["kid"]
+		if kid && key.Kty == "EC" && key.Alg == alg {
+			return &ecdsa.PublicKey{X: ParseModulo(key.X), Y: ParseModulo(key.Y), Curve: GetCurve(key.Crv)}, nil
+		}
+		if kid && (key.Kty == "RSA" || key.Alg == alg) {
+			return &rsa.PublicKey{E: ParseExponent(key.E), N: ParseModulo(key.N)}, nil
+		}
+	}
+
+	return nil, ErrTokenKey
+}
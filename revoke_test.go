@@ -0,0 +1,73 @@
+package goic
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// revokeServer gives test server that revokes tokens except "down" for which it is unavailable,
+// and records the revoked token type hints
+func revokeServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var hints []string
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		hints = append(hints, req.PostFormValue("token_type_hint"))
+		mu.Unlock()
+
+		if req.PostFormValue("token") == "down" {
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = res.Write([]byte(`{"error":"temporarily_unavailable"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), hints...)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	srv, _ := revokeServer(t)
+	g := New("/auth", false)
+	testProvider(g, "idp", &WellKnown{RevokeURI: srv.URL})
+	testProvider(g, "norevoke", nil)
+
+	if err := g.RevokeToken(&Token{Provider: "idp", AccessToken: "at"}); err != nil {
+		t.Errorf("expected 200 to be success, got %v", err)
+	}
+
+	var oe *OAuthError
+	err := g.RevokeToken(&Token{Provider: "idp", AccessToken: "down"})
+	if !errors.As(err, &oe) || oe.StatusCode != http.StatusServiceUnavailable || oe.Code != "temporarily_unavailable" {
+		t.Errorf("expected OAuthError for 503, got %v", err)
+	}
+
+	if err := g.RevokeToken(&Token{Provider: "norevoke", AccessToken: "at"}); err != ErrProviderSupport {
+		t.Errorf("expected ErrProviderSupport without revocation_endpoint, got %v", err)
+	}
+	if err := g.RevokeToken(&Token{Provider: "idp"}); err != ErrTokenAccessKey {
+		t.Errorf("expected ErrTokenAccessKey without token, got %v", err)
+	}
+}
+
+func TestRevokeTokens(t *testing.T) {
+	srv, hints := revokeServer(t)
+	g := New("/auth", false)
+	testProvider(g, "idp", &WellKnown{RevokeURI: srv.URL})
+
+	var oe *OAuthError
+	err := g.RevokeTokens(&Token{Provider: "idp", AccessToken: "at", RefreshToken: "down"})
+	if !errors.As(err, &oe) || oe.Code != "temporarily_unavailable" {
+		t.Errorf("expected error of refresh token revocation, got %v", err)
+	}
+	if got := hints(); len(got) != 2 || got[0] != "refresh_token" || got[1] != "access_token" {
+		t.Errorf("expected access token to be revoked after refresh token failed, got %v", got)
+	}
+}
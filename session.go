@@ -0,0 +1,448 @@
+package goic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSessionNone is error for missing or undecryptable session
+	ErrSessionNone = fmt.Errorf("goic session: no valid session")
+
+	// ErrSessionExpired is error for session that is past its idle or absolute expiry
+	ErrSessionExpired = fmt.Errorf("goic session: session expired")
+)
+
+var (
+	// sessionName is default session cookie name
+	sessionName = "goic"
+
+	// sessionMaxAge is default absolute session expiry
+	sessionMaxAge = 24 * time.Hour
+
+	// cookieChunk is max size of a session cookie value before it is chunked
+	cookieChunk = 3800
+)
+
+// SessionOptions configures the session cookie set after successful login
+type SessionOptions struct {
+	aeads []cipher.AEAD
+	// Store keeps sessions server side, only opaque session ID is kept in cookie.
+	// If it is nil, whole session is kept in cookie encrypted with Keys.
+	Store SessionStore
+	// Keys are AES keys of 16, 24 or 32 bytes. The first key encrypts,
+	// all keys are tried to decrypt so that keys can be rotated.
+	Keys        [][]byte
+	Name        string
+	Path        string
+	Domain      string
+	IdleTimeout time.Duration // sliding expiry, 0 to disable
+	MaxAge      time.Duration // absolute expiry, defaults to 24h
+	SameSite    http.SameSite // defaults to Lax, front-channel logout without Store needs None
+	Insecure    bool          // allows cookie over plain http, only for development
+}
+
+// Session represents logged in user session
+type Session struct {
+	User    *User         `json:"user"`
+	Token   *Token        `json:"token"`
+	Linked  []*Token      `json:"linked,omitempty"` // tokens of other providers signed into in same session
+	ID      string        `json:"id,omitempty"`
+	Subject string        `json:"sub,omitempty"`
+	SID     string        `json:"sid,omitempty"` // provider session ID
+	Created time.Time     `json:"created"`
+	Seen    time.Time     `json:"seen"`
+	Expires time.Time     `json:"expires"`
+	Idle    time.Duration `json:"idle,omitempty"` // idle timeout, so that store can expire it too
+}
+
+// WithSession enables session management after successful login
+// The session is stored in encrypted and authenticated (AES-GCM) cookie,
+// or in the SessionStore if configured.
+func (g *Goic) WithSession(o *SessionOptions) *Goic {
+	if len(o.Keys) == 0 && o.Store == nil {
+		log.Fatalf("goic session: at least one key or a store is required")
+	}
+
+	o.aeads = nil
+	for i, key := range o.Keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			log.Fatalf("goic session: key #%d invalid: %v", i, err)
+		}
+		aead, _ := cipher.NewGCM(block)
+		o.aeads = append(o.aeads, aead)
+	}
+
+	if o.Name == "" {
+		o.Name = sessionName
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	if o.MaxAge <= 0 {
+		o.MaxAge = sessionMaxAge
+	}
+	if o.SameSite == 0 {
+		o.SameSite = http.SameSiteLaxMode
+	}
+
+	g.session = o
+	return g
+}
+
+// Session gives the current Session from the request
+func (g *Goic) Session(req *http.Request) (*Session, error) {
+	o := g.session
+	if o == nil {
+		return nil, ErrSessionNone
+	}
+
+	val := readChunks(req, o.Name)
+	if val == "" {
+		return nil, ErrSessionNone
+	}
+
+	s, err := o.load(val)
+	if err != nil || s.Token == nil {
+		return nil, ErrSessionNone
+	}
+	if o.expired(s, time.Now()) {
+		if o.Store != nil {
+			_ = o.Store.Delete(s.ID)
+		}
+		return nil, ErrSessionExpired
+	}
+	if s.User == nil {
+		s.User = &User{}
+	}
+	if s.Token.IDToken != "" {
+		s.Token.Claims, _ = decodeClaims(s.Token.IDToken)
+	}
+	return s, nil
+}
+
+// SaveSession saves the Session in response, marking it as seen now
+func (g *Goic) SaveSession(res http.ResponseWriter, req *http.Request, s *Session) error {
+	o := g.session
+	if o == nil {
+		return ErrSessionNone
+	}
+
+	now := time.Now()
+	if s.Created.IsZero() {
+		s.Created = now
+	}
+	s.Seen, s.Expires, s.Idle = now, s.Created.Add(o.MaxAge), o.IdleTimeout
+
+	maxAge := int(s.Expires.Sub(now).Seconds())
+	if maxAge <= 0 {
+		return ErrSessionExpired
+	}
+
+	val, err := o.dump(s)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for ; len(val) > 0; n++ {
+		size := cookieChunk
+		if size > len(val) {
+			size = len(val)
+		}
+		http.SetCookie(res, o.cookie(chunkName(o.Name, n), val[:size], maxAge))
+		val = val[size:]
+	}
+	clearChunks(res, req, o, n)
+	return nil
+}
+
+// TouchSession gives the current Session and extends its idle expiry if enabled
+func (g *Goic) TouchSession(res http.ResponseWriter, req *http.Request) (*Session, error) {
+	s, err := g.Session(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-issue the cookie only if a good portion of idle timeout has passed
+	idle := g.session.IdleTimeout
+	if idle <= 0 || time.Since(s.Seen) <= idle/4 {
+		return s, nil
+	}
+	if store := g.session.Store; store != nil {
+		s.Seen = time.Now()
+		return s, store.Touch(s.ID, s.Seen)
+	}
+	return s, g.SaveSession(res, req, s)
+}
+
+// ClearSession removes the Session from response, and from the store if configured
+func (g *Goic) ClearSession(res http.ResponseWriter, req *http.Request) {
+	o := g.session
+	if o == nil {
+		return
+	}
+	if o.Store != nil {
+		if c, err := req.Cookie(o.Name); err == nil {
+			_ = o.Store.Delete(c.Value)
+		}
+	}
+	clearChunks(res, req, o, 0)
+}
+
+// Sessions lists all the sessions of a user by subject (sub) from the store
+func (g *Goic) Sessions(sub string) ([]*Session, error) {
+	if g.session == nil || g.session.Store == nil {
+		return nil, ErrSessionNone
+	}
+
+	ids, err := g.session.Store.BySubject(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, id := range ids {
+		if s, err := g.session.Store.Get(id); err == nil {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+// DeleteSessions deletes all the sessions of a user by subject (sub) from the store
+// It effectively logs the user out everywhere.
+func (g *Goic) DeleteSessions(sub string) error {
+	if g.session == nil || g.session.Store == nil {
+		return ErrSessionNone
+	}
+
+	ids, err := g.session.Store.BySubject(sub)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := g.session.Store.Delete(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSession creates and saves a new Session after successful login
+// Any existing session in store is discarded and new ID issued to prevent fixation.
+// The tokens of existing session are carried over only if that session asked to link by key,
+// and it is not of another user of same Provider, otherwise it starts afresh.
+func (g *Goic) newSession(tok *Token, user *User, link string, res http.ResponseWriter, req *http.Request) {
+	s := &Session{User: user, Token: tok, Subject: user.Subject, SID: claimString(tok.Claims, "sid")}
+	if s.Subject == "" {
+		s.Subject = claimString(tok.Claims, "sub")
+	}
+
+	// Link the tokens of other providers if asked so by the current session of same user
+	if old, err := g.Session(req); err == nil && link != "" && old.key() == link && old.sameUser(s) {
+		for _, t := range old.Tokens() {
+			if t.Provider != tok.Provider {
+				s.Linked = append(s.Linked, t)
+			}
+		}
+	}
+
+	if store := g.session.Store; store != nil {
+		if c, err := req.Cookie(g.session.Name); err == nil {
+			_ = store.Delete(c.Value)
+		}
+	}
+	if err := g.SaveSession(res, req, s); err != nil {
+		g.logger.ErrorContext(req.Context(), "goic session save failed", "provider", tok.Provider, "error", err)
+	}
+}
+
+// key identifies the Session, it is the ID in store or else the creation time and subject
+func (s *Session) key() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.Created.Format(time.RFC3339Nano) + " " + s.Subject
+}
+
+// sameUser checks that the Session is not of another user signed into the Provider of other
+func (s *Session) sameUser(other *Session) bool {
+	for _, t := range s.Tokens() {
+		if t.Provider != other.Token.Provider {
+			continue
+		}
+		sub := s.Subject
+		if t != s.Token {
+			claims, _ := decodeClaims(t.IDToken)
+			sub = claimString(claims, "sub")
+		}
+		if sub != other.Subject {
+			return false
+		}
+	}
+	return true
+}
+
+// Tokens gives the Token of Session and the linked tokens of other providers
+func (s *Session) Tokens() []*Token {
+	return append([]*Token{s.Token}, s.Linked...)
+}
+
+// signedInto checks if Session or its linked tokens signed into Provider by name, any if empty,
+// with given provider session ID (sid) if not empty
+func (s *Session) signedInto(name, sid string) bool {
+	for _, t := range s.Tokens() {
+		if name != "" && t.Provider != name {
+			continue
+		}
+
+		tsid := s.SID
+		if t != s.Token {
+			claims, _ := decodeClaims(t.IDToken)
+			tsid = claimString(claims, "sid")
+		}
+		if sid == "" || tsid == sid {
+			return true
+		}
+	}
+	return false
+}
+
+// expired checks if the Session is past its idle or absolute expiry
+func (o *SessionOptions) expired(s *Session, now time.Time) bool {
+	if s.expired(now) || now.After(s.Created.Add(o.MaxAge)) {
+		return true
+	}
+	return o.IdleTimeout > 0 && now.After(s.Seen.Add(o.IdleTimeout))
+}
+
+// expired checks if the Session is past its absolute or idle expiry
+func (s *Session) expired(now time.Time) bool {
+	if !s.Expires.IsZero() && now.After(s.Expires) {
+		return true
+	}
+	return s.Idle > 0 && now.After(s.Seen.Add(s.Idle))
+}
+
+// load loads the Session from cookie value
+func (o *SessionOptions) load(val string) (*Session, error) {
+	if o.Store != nil {
+		return o.Store.Get(val)
+	}
+
+	buf, err := o.decrypt(val)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	if err := json.Unmarshal(buf, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// dump saves the Session and gives the cookie value for it
+func (o *SessionOptions) dump(s *Session) (string, error) {
+	if o.Store != nil {
+		if s.ID == "" {
+			s.ID = randomID()
+		}
+		return s.ID, o.Store.Save(s)
+	}
+
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return o.encrypt(buf)
+}
+
+// encrypt encrypts buf with the first key and gives base64 url encoded value
+func (o *SessionOptions) encrypt(buf []byte) (string, error) {
+	aead := o.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	out := aead.Seal(nonce, nonce, buf, []byte(o.Name))
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+// decrypt decrypts base64 url encoded val trying all the keys
+func (o *SessionOptions) decrypt(val string) ([]byte, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, aead := range o.aeads {
+		size := aead.NonceSize()
+		if len(buf) < size {
+			break
+		}
+		if out, err := aead.Open(nil, buf[:size], buf[size:], []byte(o.Name)); err == nil {
+			return out, nil
+		}
+	}
+	return nil, ErrSessionNone
+}
+
+// cookie gives session cookie with given name and value
+func (o *SessionOptions) cookie(name, val string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    val,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   maxAge,
+		Secure:   !o.Insecure,
+		HttpOnly: true,
+		SameSite: o.SameSite,
+	}
+}
+
+// chunkName gives the cookie name of nth chunk
+func chunkName(name string, n int) string {
+	if n == 0 {
+		return name
+	}
+	return name + "." + strconv.Itoa(n)
+}
+
+// readChunks reads and joins all chunks of named cookie
+func readChunks(req *http.Request, name string) string {
+	var val strings.Builder
+	for n := 0; ; n++ {
+		c, err := req.Cookie(chunkName(name, n))
+		if err != nil {
+			break
+		}
+		val.WriteString(c.Value)
+	}
+	return val.String()
+}
+
+// clearChunks expires the chunks of session cookie in request from nth onwards
+func clearChunks(res http.ResponseWriter, req *http.Request, o *SessionOptions, n int) {
+	for ; ; n++ {
+		name := chunkName(o.Name, n)
+		if _, err := req.Cookie(name); err != nil {
+			break
+		}
+		http.SetCookie(res, o.cookie(name, "", -1))
+	}
+}
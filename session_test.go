@@ -0,0 +1,203 @@
+package goic
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 32)
+)
+
+// sessionGoic gives Goic with session of given options
+func sessionGoic(o *SessionOptions) *Goic {
+	return New("/auth", false).WithSession(o)
+}
+
+// replay gives new request carrying the cookies set in rec
+func replay(rec *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			req.AddCookie(c)
+		}
+	}
+	return req
+}
+
+// saveSession saves s and gives the request carrying its cookies
+func saveSession(t *testing.T, g *Goic, s *Session) *http.Request {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	if err := g.SaveSession(rec, httptest.NewRequest("GET", "/", nil), s); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	return replay(rec)
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	g := sessionGoic(&SessionOptions{Keys: [][]byte{testKey1}})
+	big := strings.Repeat("x", 2*cookieChunk)
+	req := saveSession(t, g, &Session{Token: &Token{Provider: "p", AccessToken: big}, User: &User{Email: "a@b.c"}})
+
+	if n := len(req.Cookies()); n < 2 {
+		t.Fatalf("expected payload over %d bytes to be chunked, got %d cookie(s)", cookieChunk, n)
+	}
+
+	s, err := g.Session(req)
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+	if s.Token.AccessToken != big || s.User.Email != "a@b.c" {
+		t.Errorf("session did not round trip: %+v", s.Token)
+	}
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	old := sessionGoic(&SessionOptions{Keys: [][]byte{testKey1}})
+	rotated := sessionGoic(&SessionOptions{Keys: [][]byte{testKey2, testKey1}})
+
+	req := saveSession(t, old, &Session{Token: &Token{Provider: "p", AccessToken: "a"}})
+	if _, err := rotated.Session(req); err != nil {
+		t.Errorf("rotated keys should decrypt session of old key: %v", err)
+	}
+
+	req = saveSession(t, rotated, &Session{Token: &Token{Provider: "p", AccessToken: "a"}})
+	if _, err := old.Session(req); err != ErrSessionNone {
+		t.Errorf("old key should not decrypt session of new key, got %v", err)
+	}
+}
+
+func TestSessionTampered(t *testing.T) {
+	g := sessionGoic(&SessionOptions{Keys: [][]byte{testKey1}})
+	req := saveSession(t, g, &Session{Token: &Token{Provider: "p", AccessToken: "a"}})
+
+	c := req.Cookies()[0]
+	val := []byte(c.Value)
+	val[len(val)/2] ^= 1
+	c.Value = string(val)
+
+	tampered := httptest.NewRequest("GET", "/", nil)
+	tampered.AddCookie(c)
+	if _, err := g.Session(tampered); err != ErrSessionNone {
+		t.Errorf("expected ErrSessionNone for tampered cookie, got %v", err)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		opt  *SessionOptions
+		s    *Session
+	}{
+		{
+			name: "absolute",
+			opt:  &SessionOptions{Keys: [][]byte{testKey1}, MaxAge: time.Hour},
+			s:    &Session{Created: now.Add(-2 * time.Hour), Seen: now, Expires: now.Add(time.Hour)},
+		},
+		{
+			name: "idle",
+			opt:  &SessionOptions{Keys: [][]byte{testKey1}, MaxAge: time.Hour, IdleTimeout: 10 * time.Minute},
+			s:    &Session{Created: now.Add(-30 * time.Minute), Seen: now.Add(-20 * time.Minute), Expires: now.Add(time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := sessionGoic(tt.opt)
+			tt.s.Token = &Token{Provider: "p", AccessToken: "a"}
+			val, err := g.session.dump(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.AddCookie(&http.Cookie{Name: g.session.Name, Value: val})
+			if _, err := g.Session(req); err != ErrSessionExpired {
+				t.Errorf("expected ErrSessionExpired, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreIdleExpiry(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]SessionStore{"memory": NewMemoryStore(), "file": fs} {
+		t.Run(name, func(t *testing.T) {
+			g := sessionGoic(&SessionOptions{Store: store, IdleTimeout: 10 * time.Minute})
+			s := &Session{Token: &Token{Provider: "p", AccessToken: "a"}, Subject: "u1", SID: "s1"}
+			saveSession(t, g, s)
+
+			if ids, _ := store.BySubject("u1"); len(ids) != 1 {
+				t.Fatalf("expected live session to be listed, got %v", ids)
+			}
+			if err := store.Touch(s.ID, time.Now().Add(-20*time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+
+			if ids, _ := store.BySubject("u1"); len(ids) != 0 {
+				t.Errorf("expected idle session not to be listed by subject, got %v", ids)
+			}
+			if ids, _ := store.BySID("s1"); len(ids) != 0 {
+				t.Errorf("expected idle session not to be listed by sid, got %v", ids)
+			}
+			if _, err := store.Get(s.ID); err != ErrSessionNone {
+				t.Errorf("expected ErrSessionNone for idle session, got %v", err)
+			}
+			if ss, _ := g.Sessions("u1"); len(ss) != 0 {
+				t.Errorf("expected no sessions, got %d", len(ss))
+			}
+		})
+	}
+}
+
+func TestNewSessionLink(t *testing.T) {
+	g := sessionGoic(&SessionOptions{Keys: [][]byte{testKey1}})
+	prev := &Token{Provider: "other", AccessToken: "a's token"}
+	idp := &Token{Provider: "idp", IDToken: signToken(t, jwt.MapClaims{"sub": "a"})}
+	req := saveSession(t, g, &Session{Token: prev, Subject: "a", Linked: []*Token{idp}})
+	old, err := g.Session(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		sub    string
+		link   string
+		linked bool
+	}{
+		{name: "another user", sub: "b"},
+		{name: "not asked", sub: "a"},
+		{name: "asked by another session", sub: "a", link: "other session"},
+		{name: "asked", sub: "a", link: old.key(), linked: true},
+		{name: "asked for another user", sub: "b", link: old.key()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			g.newSession(&Token{Provider: "idp"}, &User{Subject: tt.sub}, tt.link, rec, req)
+
+			s, err := g.Session(replay(rec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked := len(s.Linked) == 1 && s.Linked[0].AccessToken == prev.AccessToken; linked != tt.linked || (!tt.linked && len(s.Linked) > 0) {
+				t.Errorf("expected linked %v, got %+v", tt.linked, s.Linked)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package goic
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionStore is the server side storage for sessions
+// When configured, only the opaque session ID is kept in cookie.
+type SessionStore interface {
+	// Get gets a Session by ID, ErrSessionNone if not found or past its absolute or idle expiry
+	Get(id string) (*Session, error)
+	// Save creates or updates the Session by its ID
+	Save(s *Session) error
+	// Delete deletes a Session by ID, it is not an error if not found
+	Delete(id string) error
+	// Touch marks a Session as seen at given time
+	Touch(id string, seen time.Time) error
+	// BySubject lists IDs of all sessions of a user by subject (sub)
+	BySubject(sub string) ([]string, error)
+	// BySID lists IDs of all sessions by provider session ID (sid), including of linked tokens
+	BySID(sid string) ([]string, error)
+}
+
+// MemoryStore is in-memory SessionStore, sessions are lost on restart
+type MemoryStore struct {
+	sessions map[string]*Session
+	mu       sync.RWMutex
+}
+
+// NewMemoryStore gives new in-memory SessionStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*Session)}
+}
+
+// Get implements SessionStore
+func (m *MemoryStore) Get(id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[id]
+	if !ok || s.expired(time.Now()) {
+		return nil, ErrSessionNone
+	}
+	return cloneSession(s)
+}
+
+// Save implements SessionStore
+func (m *MemoryStore) Save(s *Session) error {
+	cp, err := cloneSession(s)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, v := range m.sessions {
+		if v.expired(now) {
+			delete(m.sessions, id)
+		}
+	}
+	m.sessions[s.ID] = cp
+	return nil
+}
+
+// Delete implements SessionStore
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// Touch implements SessionStore
+func (m *MemoryStore) Touch(id string, seen time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrSessionNone
+	}
+	s.Seen = seen
+	return nil
+}
+
+// BySubject implements SessionStore
+func (m *MemoryStore) BySubject(sub string) ([]string, error) {
+	return m.filter(func(s *Session) bool { return s.Subject == sub }), nil
+}
+
+// BySID implements SessionStore
+func (m *MemoryStore) BySID(sid string) ([]string, error) {
+	return m.filter(func(s *Session) bool { return s.signedInto("", sid) }), nil
+}
+
+// cloneSession gives a deep copy of Session so that stored sessions are not shared with callers
+// It is copied as serialized, the same as cookie and FileStore, so the claims are decoded on load.
+func cloneSession(s *Session) (*Session, error) {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &Session{}
+	return cp, json.Unmarshal(buf, cp)
+}
+
+// filter gives IDs of the sessions that match and are not expired
+func (m *MemoryStore) filter(match func(s *Session) bool) (ids []string) {
+	now := time.Now()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for id, s := range m.sessions {
+		if !s.expired(now) && match(s) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// FileStore is SessionStore that keeps each session as JSON file in a directory
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore gives new SessionStore backed by files in given directory
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Get implements SessionStore
+func (f *FileStore) Get(id string) (*Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.read(id)
+}
+
+// Save implements SessionStore
+func (f *FileStore) Save(s *Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.write(s)
+}
+
+// Delete implements SessionStore
+func (f *FileStore) Delete(id string) error {
+	path, ok := f.path(id)
+	if !ok {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Touch implements SessionStore
+func (f *FileStore) Touch(id string, seen time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, err := f.read(id)
+	if err != nil {
+		return err
+	}
+	s.Seen = seen
+	return f.write(s)
+}
+
+// BySubject implements SessionStore
+// It also cleans up the expired sessions as it goes.
+func (f *FileStore) BySubject(sub string) ([]string, error) {
+	return f.filter(func(s *Session) bool { return s.Subject == sub })
+}
+
+// BySID implements SessionStore
+// It also cleans up the expired sessions as it goes.
+func (f *FileStore) BySID(sid string) ([]string, error) {
+	return f.filter(func(s *Session) bool { return s.signedInto("", sid) })
+}
+
+// filter gives IDs of the sessions that match, and removes expired ones
+func (f *FileStore) filter(match func(s *Session) bool) (ids []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(f.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+		s, err := f.read(id)
+		if err == ErrSessionNone {
+			_ = os.Remove(file)
+			continue
+		}
+		if err == nil && match(s) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// path gives the file path of session by ID
+func (f *FileStore) path(id string) (string, bool) {
+	if !validID(id) {
+		return "", false
+	}
+	return filepath.Join(f.dir, id+".json"), true
+}
+
+// read reads a Session by ID, the caller must hold the lock
+func (f *FileStore) read(id string) (*Session, error) {
+	path, ok := f.path(id)
+	if !ok {
+		return nil, ErrSessionNone
+	}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNone
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	if err := json.Unmarshal(buf, s); err != nil || s.expired(time.Now()) {
+		return nil, ErrSessionNone
+	}
+	return s, nil
+}
+
+// write writes a Session atomically, the caller must hold the lock
+func (f *FileStore) write(s *Session) error {
+	path, ok := f.path(s.ID)
+	if !ok {
+		return ErrSessionNone
+	}
+
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// validID checks if session ID is safe to use as file name
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
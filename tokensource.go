@@ -0,0 +1,83 @@
+package goic
+
+import (
+	"sync"
+	"time"
+)
+
+// refreshLeeway is how early before expiry a TokenSource refreshes the Token
+var refreshLeeway = 30 * time.Second
+
+// RefreshCallback defines signature for post token refresh callback
+// The prev is the Token before refresh and tok is the refreshed Token.
+// If refresh token was rotated, prev.RefreshToken differs from tok.RefreshToken.
+type RefreshCallback func(prev, tok *Token)
+
+// TokenSource gives a valid Token, refreshing it ahead of expiry as needed
+// It is safe for concurrent use, concurrent refreshes are de-duplicated.
+type TokenSource struct {
+	g         *Goic
+	tok       *Token
+	onRefresh RefreshCallback
+	mu        sync.Mutex
+	leeway    time.Duration
+}
+
+// TokenSource gives new TokenSource for given Token
+// The Token must be from one of the providers supported by Goic.
+func (g *Goic) TokenSource(tok *Token) *TokenSource {
+	return &TokenSource{g: g, tok: tok, leeway: refreshLeeway}
+}
+
+// WithLeeway sets how early before expiry the Token is refreshed
+func (ts *TokenSource) WithLeeway(d time.Duration) *TokenSource {
+	ts.mu.Lock()
+	ts.leeway = d
+	ts.mu.Unlock()
+	return ts
+}
+
+// OnRefresh sets a callback invoked after each successful refresh, to persist new Token
+func (ts *TokenSource) OnRefresh(cb RefreshCallback) *TokenSource {
+	ts.mu.Lock()
+	ts.onRefresh = cb
+	ts.mu.Unlock()
+	return ts
+}
+
+// Token gives current Token if still valid, or refreshes it otherwise
+func (ts *TokenSource) Token() (*Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.tok.AccessToken != "" && !ts.tok.ExpiresWithin(ts.leeway) {
+		return ts.tok, nil
+	}
+	return ts.refresh()
+}
+
+// Refresh forcefully refreshes the Token unless it was already refreshed since stale was given
+func (ts *TokenSource) Refresh(stale *Token) (*Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if stale != nil && stale != ts.tok {
+		return ts.tok, nil
+	}
+	return ts.refresh()
+}
+
+// refresh refreshes the Token, the caller must hold the lock
+func (ts *TokenSource) refresh() (*Token, error) {
+	tok, err := ts.g.RefreshToken(ts.tok)
+	if err != nil {
+		return nil, err
+	}
+
+	prev := ts.tok
+	ts.tok = tok
+	if ts.onRefresh != nil {
+		ts.onRefresh(prev, tok)
+	}
+	return tok, nil
+}
@@ -0,0 +1,75 @@
+package goic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span of a Stage, shaped after OpenTelemetry span
+type SpanData struct {
+	Name       string // eg: goic.token
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Err        error // span status is error if set
+}
+
+// SpanExporter exports finished spans
+// It mirrors OpenTelemetry SpanExporter so a thin shim can bridge it to any OpenTelemetry exporter.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+}
+
+// TraceObserver is Observer that exports a span for each Stage of OpenID flow
+type TraceObserver struct {
+	Exporter SpanExporter
+}
+
+// NewTraceObserver gives new TraceObserver with given SpanExporter
+func NewTraceObserver(e SpanExporter) *TraceObserver {
+	return &TraceObserver{Exporter: e}
+}
+
+// Observe implements Observer
+func (t *TraceObserver) Observe(ctx context.Context, o Observation) {
+	attrs := map[string]string{
+		"goic.stage":    string(o.Stage),
+		"goic.provider": o.Provider,
+		"goic.outcome":  o.Outcome(),
+	}
+	if o.Err != nil {
+		attrs["error.type"] = o.ErrorCode()
+	}
+
+	span := SpanData{Name: "goic." + string(o.Stage), Start: o.Start, End: o.Start.Add(o.Duration), Attributes: attrs, Err: o.Err}
+	_ = t.Exporter.ExportSpans(ctx, []SpanData{span})
+}
+
+// InMemoryExporter is SpanExporter that keeps the spans in memory, eg: for tests
+type InMemoryExporter struct {
+	spans []SpanData
+	mu    sync.Mutex
+}
+
+// ExportSpans implements SpanExporter
+func (e *InMemoryExporter) ExportSpans(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+// Spans gives a copy of the exported spans
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset forgets the exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.mu.Unlock()
+}
@@ -0,0 +1,88 @@
+package goic
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Transport is http.RoundTripper that authorizes requests with access token from TokenSource
+// It refreshes the token when expired, or once when server responds 401 with invalid_token.
+type Transport struct {
+	Source *TokenSource
+	Base   http.RoundTripper
+}
+
+// Client gives http.Client that authorizes requests with access token of given Token
+// The optional cb is invoked with refreshed Token so it can be persisted.
+func (g *Goic) Client(tok *Token, cb ...RefreshCallback) *http.Client {
+	ts := g.TokenSource(tok)
+	if len(cb) > 0 && cb[0] != nil {
+		ts.OnRefresh(cb[0])
+	}
+	return ts.Client()
+}
+
+// Client gives http.Client that authorizes requests with access token from TokenSource
+func (ts *TokenSource) Client() *http.Client {
+	return &http.Client{Transport: &Transport{Source: ts}}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.Source.Token()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	res, err := t.base().RoundTrip(authorize(req, tok))
+	if err != nil || !invalidToken(res) || !replayable(req) {
+		return res, err
+	}
+
+	tok, err = t.Source.Refresh(tok)
+	if err != nil {
+		return res, nil // give back the original 401 response
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return res, nil
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+
+	res.Body.Close()
+	return t.base().RoundTrip(authorize(req, tok))
+}
+
+// base gives the underlying http.RoundTripper
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// authorize clones req and sets Authorization header with access token
+func authorize(req *http.Request, tok *Token) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	return r
+}
+
+// invalidToken checks if the response rejects access token as per RFC6750 (3.1)
+func invalidToken(res *http.Response) bool {
+	if res.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	return strings.Contains(res.Header.Get("WWW-Authenticate"), "invalid_token")
+}
+
+// replayable checks if the request can be sent again
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
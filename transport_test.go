@@ -0,0 +1,124 @@
+package goic
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// transportClient gives http.Client with access token "old", whose refresh gives "new"
+func transportClient(t *testing.T) (*http.Client, *int32) {
+	var refreshes int32
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+		_, _ = res.Write([]byte(`{"access_token":"new","token_type":"Bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	g := New("/auth", false)
+	testProvider(g, "idp", &WellKnown{TokenURI: srv.URL})
+	return g.Client(&Token{Provider: "idp", AccessToken: "old", RefreshToken: "r"}), &refreshes
+}
+
+// apiServer gives test server that accepts only the access token "new" and echoes the body
+func apiServer(t *testing.T, hits *int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if req.Header.Get("Authorization") != "Bearer new" {
+			res.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.Copy(res, req.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTransportReplaysBody(t *testing.T) {
+	client, refreshes := transportClient(t)
+	var hits int32
+	api := apiServer(t, &hits)
+
+	res, err := client.Post(api.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Errorf("expected replayed body after refresh, got %d %q", res.StatusCode, body)
+	}
+	if *refreshes != 1 || hits != 2 {
+		t.Errorf("expected 1 refresh and 2 hits, got %d and %d", *refreshes, hits)
+	}
+}
+
+func TestTransportRetriesOnce(t *testing.T) {
+	client, refreshes := transportClient(t)
+	var hits int32
+	api := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		res.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		res.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(api.Close)
+
+	res, err := client.Get(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized || hits != 2 || *refreshes != 1 {
+		t.Errorf("expected single retry, got status %d, %d hits and %d refreshes", res.StatusCode, hits, *refreshes)
+	}
+}
+
+func TestTransportNotReplayable(t *testing.T) {
+	client, refreshes := transportClient(t)
+	var hits int32
+	api := apiServer(t, &hits)
+
+	req, _ := http.NewRequest(http.MethodPost, api.URL, io.NopCloser(strings.NewReader("payload")))
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized || hits != 1 || *refreshes != 0 {
+		t.Errorf("expected no retry without GetBody, got status %d, %d hits and %d refreshes", res.StatusCode, hits, *refreshes)
+	}
+}
+
+func TestTransportSingleFlight(t *testing.T) {
+	client, refreshes := transportClient(t)
+	var hits int32
+	api := apiServer(t, &hits)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Get(api.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("expected 200 after refresh, got %d", res.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(refreshes); n != 1 {
+		t.Errorf("expected concurrent refreshes to be de-duplicated, got %d", n)
+	}
+}
@@ -3,7 +3,10 @@ package goic
 import (
 	"crypto/subtle"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -27,40 +30,108 @@ func (u *User) withError(err error) *User {
 	return u
 }
 
+// FromClaims fills User from the id_token claims, absent claims are left empty
 func (u *User) FromClaims(c jwt.MapClaims) *User {
-	u.Name = c["name"].(string)
-	u.GivenName = c["given_name"].(string)
-	u.FamilyName = c["family_name"].(string)
-	u.Email = c["email"].(string)
-	u.Picture = c["picture"].(string)
-	u.Subject = c["sub"].(string)
+	u.Name = claimString(c, "name")
+	u.GivenName = claimString(c, "given_name")
+	u.FamilyName = claimString(c, "family_name")
+	u.Email = claimString(c, "email")
+	u.Picture = claimString(c, "picture")
+	u.Subject = claimString(c, "sub")
 	return u
 }
 
 // Token represents token structure from well known token endpoint
 type Token struct {
-	Claims       jwt.MapClaims `json:"-"`
-	Err          string        `json:"error,omitempty"`
-	ErrDesc      string        `json:"error_description,omitempty"`
-	IDToken      string        `json:"id_token"`
-	AccessToken  string        `json:"access_token,omitempty"`
-	RefreshToken string        `json:"refresh_token,omitempty"`
-	Provider     string        `json:"provider,omitempty"`
+	Claims          jwt.MapClaims `json:"-"`
+	Act             jwt.MapClaims `json:"act,omitempty"` // actor of exchanged token if any
+	Err             string        `json:"error,omitempty"`
+	ErrDesc         string        `json:"error_description,omitempty"`
+	ErrURI          string        `json:"error_uri,omitempty"`
+	IDToken         string        `json:"id_token"`
+	AccessToken     string        `json:"access_token,omitempty"`
+	RefreshToken    string        `json:"refresh_token,omitempty"`
+	TokenType       string        `json:"token_type,omitempty"`
+	IssuedTokenType string        `json:"issued_token_type,omitempty"`
+	Scope           string        `json:"scope,omitempty"`
+	Provider        string        `json:"provider,omitempty"`
+	Expiry          time.Time     `json:"expiry"`
+	ExpiresIn       Seconds       `json:"expires_in,omitempty"`
+}
+
+// Seconds is a count of seconds that decodes from JSON number or numeric string
+// Some providers like Azure AD v1 send expires_in as string.
+type Seconds int64
+
+// UnmarshalJSON decodes Seconds from number or quoted number
+func (s *Seconds) UnmarshalJSON(b []byte) error {
+	str := strings.Trim(string(b), `"`)
+	if str == "" || str == "null" {
+		*s = 0
+		return nil
+	}
+
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return fmt.Errorf("goic token: invalid seconds %s", b)
+	}
+	*s = Seconds(n)
+	return nil
+}
+
+// setExpiry computes absolute Expiry from relative ExpiresIn at the time of receipt
+func (tok *Token) setExpiry(now time.Time) {
+	if tok.ExpiresIn > 0 {
+		tok.Expiry = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+}
+
+// Valid checks if the Token has an access token that is not yet expired
+// A Token without known Expiry is considered valid as long as it has access token
+func (tok *Token) Valid() bool {
+	return tok != nil && tok.AccessToken != "" && !tok.ExpiresWithin(0)
+}
+
+// ExpiresWithin checks if the Token expires within given duration from now
+// It is always false when the Expiry is not known
+func (tok *Token) ExpiresWithin(d time.Duration) bool {
+	if tok.Expiry.IsZero() {
+		return false
+	}
+	return !time.Now().Add(d).Before(tok.Expiry)
+}
+
+// MissingScopes gives the scopes from requested scope s that were not granted
+// As per RFC6749 (5.1), if the provider omits scope then it is same as requested
+func (tok *Token) MissingScopes(s string) (missing []string) {
+	if tok.Scope == "" {
+		return nil
+	}
+
+	granted := map[string]bool{}
+	for _, v := range strings.Fields(tok.Scope) {
+		granted[v] = true
+	}
+	for _, v := range strings.Fields(s) {
+		if !granted[v] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
+
+// Downscoped checks if the provider granted less than the requested scope s
+func (tok *Token) Downscoped(s string) bool {
+	return len(tok.MissingScopes(s)) > 0
 }
 
 // verifyClaims verifies the claims of a Token
 func (tok *Token) VerifyClaims(nonce, aud string) (err error) {
-	claims := jwt.MapClaims{}
 	tok.Claims = jwt.MapClaims{}
 
-	seg := strings.Split(tok.IDToken, ".")
-	if len(seg) != 3 {
-		return ErrTokenInvalid
-	}
-
-	buf, _ := Base64UrlDecode(seg[1])
-	if err := json.Unmarshal(buf, &claims); err != nil {
-		return ErrTokenClaims
+	claims, err := decodeClaims(tok.IDToken)
+	if err != nil {
+		return err
 	}
 
 	usrNonce, ok := claims["nonce"]
@@ -75,3 +146,24 @@ func (tok *Token) VerifyClaims(nonce, aud string) (err error) {
 	tok.Claims = claims // attach only if valid
 	return nil
 }
+
+// decodeClaims decodes the claims segment of a JWT without verifying it
+func decodeClaims(token string) (jwt.MapClaims, error) {
+	seg := strings.Split(token, ".")
+	if len(seg) != 3 {
+		return nil, ErrTokenInvalid
+	}
+
+	claims := jwt.MapClaims{}
+	buf, _ := Base64UrlDecode(seg[1])
+	if err := json.Unmarshal(buf, &claims); err != nil {
+		return nil, ErrTokenClaims
+	}
+	return claims, nil
+}
+
+// claimString gets a string claim by name, empty if absent or not string
+func claimString(c jwt.MapClaims, name string) string {
+	s, _ := c[name].(string)
+	return s
+}
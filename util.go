@@ -2,11 +2,14 @@ package goic
 
 import (
 	"crypto/elliptic"
+	crand "crypto/rand"
 	"encoding/base64"
-	"log"
+	"encoding/json"
+	"errors"
 	"math/big"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -27,6 +30,15 @@ func RandomString(len int) string {
 	return string(str)
 }
 
+// randomID generates cryptographically secure random ID safe for use in URL and file name
+func randomID() string {
+	buf := make([]byte, 32)
+	if _, err := crand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
 // Base64UrlDecode decodes JWT segments with base64 accounting for URL chars
 func Base64UrlDecode(s string) ([]byte, error) {
 	pad := len(s) % 4
@@ -67,6 +79,21 @@ func GetCurve(s string) elliptic.Curve {
 	return elliptic.P224()
 }
 
+// baseURL gets the scheme and host of current request URL
+func baseURL(req *http.Request) string {
+	u := url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	if u.Host == "" {
+		u.Host = req.Header.Get("Host")
+		if u.Host == "" {
+			u.Host = req.Host
+		}
+	}
+	return u.String()
+}
+
 // currentURL gets the current request URL with/without query
 func currentURL(req *http.Request, query bool) string {
 	u := req.URL
@@ -86,16 +113,28 @@ func currentURL(req *http.Request, query bool) string {
 	return u.String()
 }
 
-// trapError recovers panics during OpenID operation
-func trapError(res http.ResponseWriter) {
-	msg := "Something went wrong"
-	if rec := recover(); rec != nil {
-		switch typ := rec.(type) {
-		case error:
-			log.Printf("goic uncaught: %v\n", typ)
-			msg = typ.Error()
-		}
+// providerPath gives provider name and sub action from the path under URI prefix
+// Eg: /auth/o8/google gives google, /auth/o8/google/ciba gives google and ciba.
+func providerPath(path, prefix string) (name, action string) {
+	name = strings.TrimPrefix(strings.TrimPrefix(path, prefix), "/")
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name, action = name[:i], name[i+1:]
+	}
+	return name, action
+}
 
-		http.Error(res, msg, http.StatusInternalServerError)
+// writeJSON writes v as JSON response with given status
+func writeJSON(res http.ResponseWriter, status int, v any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(status)
+	_ = json.NewEncoder(res).Encode(v)
+}
+
+// trapError recovers panics during OpenID operation, the details are only logged
+func (g *Goic) trapError(res http.ResponseWriter, req *http.Request) {
+	if rec := recover(); rec != nil {
+		g.logger.ErrorContext(req.Context(), "goic uncaught panic", "path", req.URL.Path, "panic", rec)
+		g.handleError(res, req, errors.New("panic"), "process", nil)
 	}
 }